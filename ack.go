@@ -0,0 +1,228 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"reflect"
+	"time"
+)
+
+// DefaultVisibilityTimeout is the visibility timeout used when AckConfig.VisibilityTimeout
+// is not set.
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// AckConfig configures at-least-once delivery for a fan-in. In this mode the consumer
+// receives each element wrapped in a *Delivery and must call its Ack method once the element
+// has been processed. Elements that are not acknowledged within the visibility timeout, or
+// that are explicitly rejected with Nack, are delivered again.
+type AckConfig struct {
+	// VisibilityTimeout is how long the consumer has to acknowledge a delivery before the
+	// element is delivered again. If it is not positive, DefaultVisibilityTimeout is used.
+	VisibilityTimeout time.Duration
+
+	// MaxInFlight, if positive, limits the number of unacknowledged deliveries. Once the
+	// limit is reached, no new elements are received from the inputs until the consumer
+	// acknowledges (or rejects) some of them.
+	MaxInFlight int
+
+	// OnCommit, if set, is called with each delivery once it has been acknowledged, so that
+	// the source of the input it came from can be told that it was processed. It is called
+	// from the fan-in's goroutine, and only once per element regardless of how many times it
+	// was delivered.
+	OnCommit func(*Delivery)
+}
+
+// Delivery is an element fanned in with at-least-once delivery. If an element is delivered
+// more than once, each delivery is a distinct *Delivery with the same Input and Seq.
+type Delivery struct {
+	// Value is the element that was received.
+	Value interface{}
+	// Input is the index of the channel (as passed to FanIn) that Value was received from.
+	Input int
+	// Seq is the position of Value among the elements received from its input, starting at 1.
+	Seq uint64
+	// Attempt counts how many times Value has been delivered, starting at 1.
+	Attempt int
+
+	id      uint64
+	tracker *ackTracker
+}
+
+var deliveryType = reflect.TypeOf((*Delivery)(nil))
+
+// Ack marks the element as processed. It is safe to call more than once, and to call on a
+// delivery that has already timed out (in which case the element will still be committed,
+// though a redelivery may already be on its way).
+func (d *Delivery) Ack() {
+	d.tracker.send(d.tracker.acks, d.id)
+}
+
+// Nack rejects the element so that it is delivered again immediately, without waiting for
+// the visibility timeout. It has no effect if the element has already been acknowledged.
+func (d *Delivery) Nack() {
+	d.tracker.send(d.tracker.nacks, d.id)
+}
+
+// ackTracker holds the state of a fan-in in at-least-once mode.
+type ackTracker struct {
+	acks, nacks chan uint64
+	stopped     chan struct{}
+}
+
+// send passes a delivery's id to the tracker's goroutine unless it has already stopped.
+func (t *ackTracker) send(events chan<- uint64, id uint64) {
+	select {
+	case events <- id:
+	case <-t.stopped:
+	}
+}
+
+// inFlight is an element that has been delivered but not yet acknowledged.
+type inFlight struct {
+	delivery *Delivery
+	deadline time.Time
+}
+
+func (c *AckConfig) tag(input int) func(reflect.Value) reflect.Value {
+	var seq uint64
+	return func(elem reflect.Value) reflect.Value {
+		if !elem.IsValid() {
+			return reflect.Value{}
+		}
+		seq++
+		return reflect.ValueOf(&Delivery{
+			Value:   elem.Interface(),
+			Input:   input,
+			Seq:     seq,
+			Attempt: 1,
+		})
+	}
+}
+
+func (c *AckConfig) commit(delivery *Delivery) {
+	if c.OnCommit != nil {
+		c.OnCommit(delivery)
+	}
+}
+
+// manage delivers elements received on in to out, and delivers them again if they are not
+// acknowledged in time. It closes out when done closes, or once in has closed and every element
+// has been acknowledged.
+func (c *AckConfig) manage(done <-chan struct{}, in, out chan *Delivery) {
+	defer close(out)
+	tracker := &ackTracker{
+		acks:    make(chan uint64),
+		nacks:   make(chan uint64),
+		stopped: make(chan struct{}),
+	}
+	defer close(tracker.stopped)
+	timeout := c.VisibilityTimeout
+	if timeout <= 0 {
+		timeout = DefaultVisibilityTimeout
+	}
+	var (
+		input  = in
+		nextID uint64
+		// ready holds deliveries waiting to be sent, oldest first
+		ready []*Delivery
+		// pending holds deliveries that have been sent but not acknowledged, and order holds
+		// them in the order they were sent (and will therefore expire)
+		pending = make(map[uint64]*inFlight)
+		order   []*inFlight
+		timer   = time.NewTimer(timeout)
+	)
+	defer timer.Stop()
+	redeliver := func(id uint64) {
+		entry, ok := pending[id]
+		if !ok {
+			return
+		}
+		delete(pending, id)
+		again := *entry.delivery
+		again.Attempt++
+		ready = append(ready, &again)
+	}
+	// stale reports whether an entry in order has since been acknowledged or redelivered
+	stale := func(entry *inFlight) bool {
+		return pending[entry.delivery.id] != entry
+	}
+	for {
+		for len(order) > 0 && stale(order[0]) {
+			order = order[1:]
+		}
+		if input == nil && len(ready) == 0 && len(pending) == 0 {
+			return
+		}
+		// only receive new elements when there is nothing waiting to be redelivered and we
+		// are below the in-flight limit
+		receive := input
+		if len(ready) > 0 || (c.MaxInFlight > 0 && len(pending) >= c.MaxInFlight) {
+			receive = nil
+		}
+		var send chan *Delivery
+		var next *Delivery
+		if len(ready) > 0 {
+			send, next = out, ready[0]
+		}
+		var expired <-chan time.Time
+		if len(order) > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(order[0].deadline))
+			expired = timer.C
+		}
+		select {
+		case <-done:
+			if input != nil {
+				go drain(reflect.ValueOf(input))
+			}
+			return
+		case delivery, more := <-receive:
+			if !more {
+				input = nil
+				continue
+			}
+			nextID++
+			delivery.id, delivery.tracker = nextID, tracker
+			ready = append(ready, delivery)
+		case send <- next:
+			ready = ready[1:]
+			entry := &inFlight{delivery: next, deadline: time.Now().Add(timeout)}
+			pending[next.id] = entry
+			order = append(order, entry)
+		case id := <-tracker.acks:
+			acked, ok := pending[id]
+			if ok {
+				delete(pending, id)
+				c.commit(acked.delivery)
+				continue
+			}
+			// the element may be waiting to be redelivered
+			for i, delivery := range ready {
+				if delivery.id == id {
+					ready = append(ready[:i], ready[i+1:]...)
+					c.commit(delivery)
+					break
+				}
+			}
+		case id := <-tracker.nacks:
+			redeliver(id)
+		case <-expired:
+			now := time.Now()
+			for len(order) > 0 && (stale(order[0]) || !order[0].deadline.After(now)) {
+				if !stale(order[0]) {
+					redeliver(order[0].delivery.id)
+				}
+				order = order[1:]
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func receiveDelivery(t *testing.T, out <-chan *fan.Delivery, timeout time.Duration) *fan.Delivery {
+	select {
+	case <-time.NewTicker(timeout).C:
+		t.Fatalf("timed out")
+	case d, more := <-out:
+		if !more {
+			t.Fatalf("channel closed unexpectedly")
+		}
+		return d
+	}
+	return nil
+}
+
+func TestAckCommits(t *testing.T) {
+	var committed []int
+	config := fan.Ints()
+	config.Ack = &fan.AckConfig{
+		OnCommit: func(d *fan.Delivery) {
+			committed = append(committed, d.Input*10+int(d.Seq))
+		},
+	}
+	a, b := make(chan int), make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	out := config.FanIn(done, a, b).(<-chan *fan.Delivery)
+	go func() {
+		defer close(a)
+		a <- 1
+		a <- 2
+	}()
+	go func() {
+		defer close(b)
+		b <- 3
+	}()
+	for i := 0; i < 3; i++ {
+		d := receiveDelivery(t, out, time.Millisecond*10)
+		if d.Attempt != 1 {
+			t.Fatalf("expected first attempt, got %d", d.Attempt)
+		}
+		d.Ack()
+		d.Ack() // acking twice is harmless
+	}
+	if _, more := <-out; more {
+		t.Fatalf("channel is not closed after inputs closed and all elements acknowledged")
+	}
+	sort.Ints(committed)
+	expectInts(t, []int{1, 2, 11}, committed)
+}
+
+func TestAckRedeliversAfterTimeout(t *testing.T) {
+	in := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	config := fan.Config{Ack: &fan.AckConfig{VisibilityTimeout: time.Millisecond * 20}}
+	out := config.FanIn(done, in).(<-chan *fan.Delivery)
+	go func() {
+		defer close(in)
+		in <- 5
+	}()
+	first := receiveDelivery(t, out, time.Millisecond*10)
+	// don't ack, so it should come back
+	second := receiveDelivery(t, out, time.Millisecond*100)
+	if second.Value.(int) != 5 || second.Attempt != 2 || second.Seq != first.Seq {
+		t.Fatalf("expected second attempt of the same element, got %+v", second)
+	}
+	second.Ack()
+	select {
+	case <-time.NewTicker(time.Millisecond * 100).C:
+		t.Fatalf("timed out")
+	case _, more := <-out:
+		if more {
+			t.Fatalf("channel should close once the element is acknowledged")
+		}
+	}
+}
+
+func TestAckNack(t *testing.T) {
+	in := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	config := fan.Config{Ack: &fan.AckConfig{VisibilityTimeout: time.Hour}}
+	out := config.FanIn(done, in).(<-chan *fan.Delivery)
+	go func() {
+		in <- 5
+	}()
+	receiveDelivery(t, out, time.Millisecond*10).Nack()
+	if d := receiveDelivery(t, out, time.Millisecond*10); d.Attempt != 2 {
+		t.Fatalf("expected immediate redelivery, got attempt %d", d.Attempt)
+	}
+}
+
+func TestAckMaxInFlight(t *testing.T) {
+	in := make(chan int, 3)
+	in <- 0
+	in <- 1
+	in <- 2
+	done := make(chan struct{})
+	defer close(done)
+	config := fan.Config{Ack: &fan.AckConfig{MaxInFlight: 1}}
+	out := config.FanIn(done, in).(<-chan *fan.Delivery)
+	first := receiveDelivery(t, out, time.Millisecond*10)
+	select {
+	case d := <-out:
+		t.Fatalf("should not deliver %v while the limit is reached", d.Value)
+	case <-time.NewTicker(time.Millisecond * 10).C:
+	}
+	first.Ack()
+	receiveDelivery(t, out, time.Millisecond*10)
+}
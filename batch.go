@@ -0,0 +1,56 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"reflect"
+)
+
+// batcher moves the elements of a fan-in from its workers to its stages in batches. Each
+// worker sends batches of the elements that are already buffered on its input, and a single
+// goroutine unpacks them. It is implemented for each element type by Batched.
+type batcher interface {
+	// elementType is the element type of the channels that can be batched
+	elementType() reflect.Type
+	// batchType is the type of the batches that the workers send
+	batchType() reflect.Type
+	// size is the most elements in a batch
+	size() int
+	// selectFunc returns the workers' loop body, which receives from a <-chan of the element
+	// type and sends batches on a chan of batchType
+	selectFunc() SelectFunc
+	// unbatch sends each element of each batch received on in, a <-chan of batchType, to
+	// out, a chan of the element type, until in closes or done closes
+	unbatch(done <-chan struct{}, in, out interface{})
+}
+
+// run starts the workers of a fan-in whose stages are p, and calls finished once the workers
+// have all stopped sending. If the config is batched, the workers' loop bodies are replaced
+// with the batcher's.
+func (c Config) run(done <-chan struct{}, p pipeline, workers []worker, finished func()) {
+	if c.batch == nil {
+		p.run(done, workers, finished)
+		return
+	}
+	batchType := c.batch.batchType()
+	batches := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, batchType), 0)
+	// the workers send batches through a pipeline of their own, which keeps its recovery,
+	// watchdog and pool
+	workerPipeline := p
+	workerPipeline.elementType, workerPipeline.sink = batchType, batches
+	loopBody := c.batch.selectFunc()
+	for i := range workers {
+		workers[i].loopBody, workers[i].reflective = loopBody, false
+	}
+	workerPipeline.run(done, workers, batches.Close)
+	in := batches.Convert(reflect.ChanOf(reflect.RecvDir, batchType)).Interface()
+	out := p.sink.Interface()
+	p.pool.run(func() {
+		defer finished()
+		c.batch.unbatch(done, in, out)
+	})
+}
@@ -0,0 +1,123 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Batched returns a copy of c that moves elements of type T in batches of up to size. Rather
+// than receiving and sending one element at a time, each worker receives an element, takes
+// whatever else is already buffered on its input without waiting for more, and hands them over
+// in a single send. One goroutine unpacks the batches onto the output, so the output's type is
+// unchanged, and the elements of each input keep their order. Since only that goroutine sends
+// on the output, the output has room for a batch, and the consumer can receive a batch's
+// elements without waiting on each send.
+//
+// Batching pays off when inputs are buffered and producers keep them full. With unbuffered
+// inputs, or inputs that rarely hold more than one element, every batch holds a single element
+// and batching only adds a step (see BenchmarkBatched). FanIn, FanInTo, FanInSharded,
+// FanInStream and Plan all batch, and do not use the config's SelectFunc. FanInAs, Flatten and
+// SwitchLatest move elements one at a time.
+//
+// This will panic if size is less than one. Fanning in with the returned config will panic if
+// the channels' element type is not T, if the config sets Ack or Envelope, or if it is combined
+// with operators that wrap elements, such as MergeEventTime.
+func Batched[T any](c Config, size int) Config {
+	if size < 1 {
+		panic(fmt.Errorf("Batched() requires a positive size, got %d", size))
+	}
+	c.batch = &batches[T]{max: size}
+	return c
+}
+
+// batches is the batcher for elements of type T. Batches are sent as *[]T, and recycled once
+// they have been unpacked.
+type batches[T any] struct {
+	max  int
+	free sync.Pool
+}
+
+func (b *batches[T]) elementType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (b *batches[T]) batchType() reflect.Type {
+	return reflect.TypeOf((*[]T)(nil))
+}
+
+func (b *batches[T]) size() int {
+	return b.max
+}
+
+func (b *batches[T]) selectFunc() SelectFunc {
+	return b.move
+}
+
+// move is the workers' loop body. It works like a SelectFunc, but sends a batch of the
+// elements that are ready instead of a single one.
+func (b *batches[T]) move(done <-chan struct{}, in, out interface{}) bool {
+	input := in.(<-chan T)
+	var batch *[]T
+	select {
+	case <-done:
+		return true
+	case element, more := <-input:
+		if !more {
+			return true
+		}
+		batch, _ = b.free.Get().(*[]T)
+		if batch == nil {
+			batch = new([]T)
+		}
+		*batch = append(*batch, element)
+	}
+	closed := false
+drain:
+	for len(*batch) < b.max {
+		select {
+		case element, more := <-input:
+			if !more {
+				closed = true
+				break drain
+			}
+			*batch = append(*batch, element)
+		default:
+			break drain
+		}
+	}
+	select {
+	case <-done:
+		return true
+	case out.(chan *[]T) <- batch:
+	}
+	return closed
+}
+
+func (b *batches[T]) unbatch(done <-chan struct{}, in, out interface{}) {
+	output := out.(chan T)
+	// the workers stop sending once done closes, after which in closes
+	for batch := range in.(<-chan *[]T) {
+		var zero T
+		for i, element := range *batch {
+			select {
+			case <-done:
+				return
+			case output <- element:
+			}
+			// don't keep the element alive while the batch waits to be reused
+			(*batch)[i] = zero
+		}
+		*batch = (*batch)[:0]
+		b.free.Put(batch)
+	}
+}
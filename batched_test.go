@@ -0,0 +1,170 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestBatched(t *testing.T) {
+	const numChannels, numElements = 4, 100
+	for name, config := range map[string]fan.Config{
+		"plain":     fan.Batched[int](fan.Config{}, 8),
+		"single":    fan.Batched[int](fan.Ints(), 1),
+		"queued":    fan.Batched[int](fan.Config{QueueSize: 10}, 8),
+		"recovered": fan.Batched[int](fan.Config{Recover: &fan.RecoverConfig{}}, 8),
+	} {
+		t.Run(name, func(t *testing.T) {
+			done := make(chan struct{})
+			defer close(done)
+			inputs := make([]interface{}, numChannels)
+			for i := range inputs {
+				input := make(chan int, numElements)
+				for j := 0; j < numElements; j++ {
+					input <- i*numElements + j
+				}
+				close(input)
+				inputs[i] = input
+			}
+			var received []int
+			// the elements of each input arrive in order
+			last := make([]int, numChannels)
+			for i := range last {
+				last[i] = -1
+			}
+			for elem := range config.FanIn(done, inputs...).(<-chan int) {
+				input := elem / numElements
+				if elem <= last[input] {
+					t.Fatalf("received %d after %d", elem, last[input])
+				}
+				last[input] = elem
+				received = append(received, elem)
+			}
+			if len(received) != numChannels*numElements {
+				t.Fatalf("expected %d elements, got %d", numChannels*numElements, len(received))
+			}
+		})
+	}
+}
+
+func TestBatchedStream(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	stream := fan.FanInStream(fan.Batched[int](fan.Config{}, 4), done, sendAll(1, 2, 3), sendAll(4, 5))
+	var received []int
+	stream.Range(func(elem int) bool {
+		received = append(received, elem)
+		return true
+	})
+	sort.Ints(received)
+	expectInts(t, []int{1, 2, 3, 4, 5}, received)
+	stream.Wait()
+	if err := stream.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBatchedDone(t *testing.T) {
+	done := make(chan struct{})
+	input := make(chan int, 1)
+	input <- 1
+	out := fan.Batched[int](fan.Config{}, 4).FanIn(done, input).(<-chan int)
+	if elem := receiveInt(t, out); elem != 1 {
+		t.Fatalf("expected 1, got %d", elem)
+	}
+	close(done)
+	expectInts(t, nil, receiveAll(t, out))
+}
+
+func TestBatchedInvalid(t *testing.T) {
+	expectPanic := func(t *testing.T, f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected a panic")
+			}
+		}()
+		f()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	t.Run("size", func(t *testing.T) {
+		expectPanic(t, func() { fan.Batched[int](fan.Config{}, 0) })
+	})
+	t.Run("element type", func(t *testing.T) {
+		expectPanic(t, func() { fan.Batched[int](fan.Config{}, 4).FanIn(done, make(chan string)) })
+	})
+	t.Run("ack", func(t *testing.T) {
+		expectPanic(t, func() {
+			fan.Batched[int](fan.Config{Ack: &fan.AckConfig{}}, 4).FanIn(done, make(chan int))
+		})
+	})
+	t.Run("envelope", func(t *testing.T) {
+		expectPanic(t, func() {
+			fan.Batched[int](fan.Config{Envelope: &fan.EnvelopeConfig{}}, 4).FanIn(done, make(chan int))
+		})
+	})
+}
+
+// BenchmarkBatched compares batched transfer with the hybrid-closure implementation from
+// BenchmarkFanIn, using the same buffered inputs.
+func BenchmarkBatched(b *testing.B) {
+	closure := fan.Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan benchInt):
+				if !more {
+					return true
+				}
+				out.(chan benchInt) <- element
+			}
+			return false
+		},
+	}
+	for _, numChannels := range []int{1, 10, 100} {
+		for _, numElements := range []int{100, 10000, 100000} {
+			for _, impl := range []struct {
+				Name   string
+				Config fan.Config
+			}{
+				{Name: "hybrid-closure", Config: closure},
+				{Name: "batched-16", Config: fan.Batched[benchInt](fan.Config{}, 16)},
+				{Name: "batched-256", Config: fan.Batched[benchInt](fan.Config{}, 256)},
+			} {
+				b.Run(fmt.Sprintf("chans:%d,elems:%d,impl:%s", numChannels, numElements, impl.Name), func(b *testing.B) {
+					inputs := make([]chan benchInt, numChannels)
+					asGeneric := make([]interface{}, numChannels)
+					for i := range inputs {
+						inputs[i] = make(chan benchInt, numElements/numChannels+(numElements%numChannels))
+						asGeneric[i] = inputs[i]
+					}
+					done := make(chan struct{})
+					defer close(done)
+					output := impl.Config.FanIn(done, asGeneric...).(<-chan benchInt)
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						go func() {
+							for i := 0; i < numElements; i++ {
+								inputs[i%len(inputs)] <- benchInt(i)
+							}
+						}()
+						for i := 0; i < numElements; i++ {
+							<-output
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,312 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// BusConfig configures a Bus.
+type BusConfig struct {
+	// Config is used to fan in the publishers of each topic, so its SelectFunc should be
+	// specialized to the bus's element type. It may not set Ack or Envelope.
+	Config Config
+
+	// Buffer is the number of messages that each subscription can hold while its consumer is
+	// not ready. If it is zero, subscriptions are unbuffered.
+	Buffer int
+
+	// Overflow determines what happens to messages that arrive for a subscription while its
+	// buffer is full. With the Block policy a slow subscriber stalls the whole bus, while with
+	// DropNewest or DropOldest it never does. It has no effect unless Buffer is positive.
+	Overflow OverflowPolicy
+
+	// Replay is the number of most recent messages on each topic that are retained and
+	// delivered to new subscribers before any live messages.
+	Replay int
+}
+
+// Bus is an in-process publish/subscribe bus for messages of a single element type. Topics
+// are dot-separated names such as "orders.eu.created". Subscribers choose topics with
+// patterns in which "*" matches any single segment and a final ">" matches one or more
+// trailing segments, so "orders.*.created" and "orders.>" both match the topic above.
+//
+// The publishers of each topic are fanned in using the BusConfig's Config, and each message
+// is broadcast to every subscription whose pattern matches its topic. Messages from a single
+// publisher are delivered to each subscriber in the order they were published. A Bus's
+// methods are safe for concurrent use.
+type Bus struct {
+	BusConfig
+	elementType reflect.Type
+	commands    chan busCommand
+	stopped     chan struct{}
+}
+
+// busCommandKind identifies what a busCommand asks for.
+type busCommandKind int
+
+const (
+	busPublish busCommandKind = iota
+	busSubscribe
+	busUnsubscribe
+)
+
+// busCommand asks the bus's goroutine to create publishers for a topic, to subscribe to a
+// pattern, or to cancel a subscription, as determined by kind. The result is sent on reply.
+type busCommand struct {
+	kind        busCommandKind
+	publish     string
+	publishers  int
+	subscribe   string
+	unsubscribe interface{}
+	reply       chan interface{}
+}
+
+// busSource is the output of a fan-in of some of a topic's publishers.
+type busSource struct {
+	topic  string
+	output reflect.Value
+}
+
+// busRecord is a message retained for replay.
+type busRecord struct {
+	seq   uint64
+	value reflect.Value
+}
+
+type busSubscriber struct {
+	pattern string
+	intake  reflect.Value
+	active  bool
+}
+
+// NewBus starts a bus for messages with the given element type. The bus stops, closing every
+// subscription, when done closes. This will panic if config.Config sets Ack or Envelope.
+func NewBus(done <-chan struct{}, elementType reflect.Type, config BusConfig) *Bus {
+	if config.Config.Ack != nil || config.Config.Envelope != nil {
+		panic(fmt.Errorf("NewBus() cannot use a Config that sets Ack or Envelope"))
+	}
+	b := &Bus{
+		BusConfig:   config,
+		elementType: elementType,
+		commands:    make(chan busCommand),
+		stopped:     make(chan struct{}),
+	}
+	go b.run(done)
+	return b
+}
+
+// Publishers creates n channels for publishing to topic and returns them as send-only
+// channels of the bus's element type, which must be type-asserted by the caller. Close each
+// channel when finished publishing on it. The channels are fanned in together, so when
+// several publishers are known up front it is more efficient to create them in one call.
+// Channels created after the bus has stopped are never read.
+func (b *Bus) Publishers(topic string, n int) []interface{} {
+	if n < 1 {
+		return nil
+	}
+	reply := make(chan interface{})
+	select {
+	case b.commands <- busCommand{kind: busPublish, publish: topic, publishers: n, reply: reply}:
+		return (<-reply).([]interface{})
+	case <-b.stopped:
+		publishers := make([]interface{}, n)
+		for i := range publishers {
+			publishers[i] = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, b.elementType), 0).
+				Convert(reflect.ChanOf(reflect.SendDir, b.elementType)).Interface()
+		}
+		return publishers
+	}
+}
+
+// Publisher creates a single channel for publishing to topic. See Publishers.
+func (b *Bus) Publisher(topic string) interface{} {
+	return b.Publishers(topic, 1)[0]
+}
+
+// Subscribe returns a receive-only channel of the bus's element type (which must be
+// type-asserted by the caller) that will receive every message published to a topic matching
+// pattern, beginning with any retained messages. The channel closes when the subscription is
+// cancelled with Unsubscribe or the bus stops.
+func (b *Bus) Subscribe(pattern string) interface{} {
+	reply := make(chan interface{})
+	select {
+	case b.commands <- busCommand{kind: busSubscribe, subscribe: pattern, reply: reply}:
+		return <-reply
+	case <-b.stopped:
+		closed := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, b.elementType), 0)
+		closed.Close()
+		return closed.Convert(reflect.ChanOf(reflect.RecvDir, b.elementType)).Interface()
+	}
+}
+
+// Unsubscribe cancels a subscription, given the channel returned by Subscribe. Messages already
+// buffered for the subscription are still delivered, then its channel closes. It reports
+// whether the subscription was active.
+func (b *Bus) Unsubscribe(subscription interface{}) bool {
+	reply := make(chan interface{})
+	select {
+	case b.commands <- busCommand{kind: busUnsubscribe, unsubscribe: subscription, reply: reply}:
+		return (<-reply).(bool)
+	case <-b.stopped:
+		return false
+	}
+}
+
+// matchTopic reports whether topic matches pattern.
+func matchTopic(pattern, topic string) bool {
+	patternSegments := strings.Split(pattern, ".")
+	topicSegments := strings.Split(topic, ".")
+	for i, segment := range patternSegments {
+		if segment == ">" && i == len(patternSegments)-1 {
+			return len(topicSegments) > i
+		}
+		if i >= len(topicSegments) || (segment != "*" && segment != topicSegments[i]) {
+			return false
+		}
+	}
+	return len(patternSegments) == len(topicSegments)
+}
+
+// run owns all of the bus's state. It receives messages from every topic's sources and
+// broadcasts them, while also handling commands.
+func (b *Bus) run(done <-chan struct{}) {
+	var (
+		sources     []busSource
+		subscribers = make(map[interface{}]*busSubscriber)
+		history     = make(map[string][]busRecord)
+		seq         uint64
+	)
+	defer func() {
+		close(b.stopped)
+		for _, subscriber := range subscribers {
+			subscriber.intake.Close()
+		}
+		// let the fan-ins of our sources finish
+		for _, source := range sources {
+			go drain(source.output)
+		}
+	}()
+	chanType := reflect.ChanOf(reflect.BothDir, b.elementType)
+	handle := func(command busCommand) {
+		switch command.kind {
+		case busPublish:
+			publishers := make([]interface{}, command.publishers)
+			inputs := make([]interface{}, command.publishers)
+			for i := range publishers {
+				publisher := reflect.MakeChan(chanType, 0)
+				inputs[i] = publisher.Interface()
+				publishers[i] = publisher.Convert(reflect.ChanOf(reflect.SendDir, b.elementType)).Interface()
+			}
+			sources = append(sources, busSource{
+				topic:  command.publish,
+				output: reflect.ValueOf(b.Config.FanIn(done, inputs...)),
+			})
+			command.reply <- publishers
+		case busSubscribe:
+			// gather the retained messages for every matching topic in publication order
+			var replay []busRecord
+			for topic, records := range history {
+				if matchTopic(command.subscribe, topic) {
+					replay = append(replay, records...)
+				}
+			}
+			sort.Slice(replay, func(i, j int) bool { return replay[i].seq < replay[j].seq })
+			intake := reflect.MakeChan(chanType, 0)
+			output := intake
+			// make sure the buffer has room for the replay so that sending it cannot block
+			if size := b.Buffer + len(replay); size > 0 {
+				output = reflect.MakeChan(chanType, 0)
+				go Config{QueueSize: size, Overflow: b.Overflow}.queue(done, intake, output, nil)
+			}
+			for _, record := range replay {
+				intake.Send(record.value)
+			}
+			subscription := output.Convert(reflect.ChanOf(reflect.RecvDir, b.elementType)).Interface()
+			subscribers[subscription] = &busSubscriber{pattern: command.subscribe, intake: intake, active: true}
+			command.reply <- subscription
+		case busUnsubscribe:
+			subscriber, ok := subscribers[command.unsubscribe]
+			if ok {
+				subscriber.intake.Close()
+				subscriber.active = false
+				delete(subscribers, command.unsubscribe)
+			}
+			command.reply <- ok
+		}
+	}
+	const (
+		DoneChanClosed  = 0
+		CommandReceived = 1
+		FirstSource     = 2
+	)
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed:  {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		CommandReceived: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(b.commands)},
+	}
+	var targets []*busSubscriber
+	for {
+		selectConfig = selectConfig[:FirstSource]
+		for _, source := range sources {
+			selectConfig = append(selectConfig, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: source.output})
+		}
+		caseChosen, received, more := reflect.Select(selectConfig)
+		switch {
+		case caseChosen == DoneChanClosed:
+			return
+		case caseChosen == CommandReceived:
+			handle(received.Interface().(busCommand))
+			continue
+		case !more:
+			// every publisher in this group has closed
+			sources = append(sources[:caseChosen-FirstSource], sources[caseChosen-FirstSource+1:]...)
+			continue
+		}
+		topic := sources[caseChosen-FirstSource].topic
+		if b.Replay > 0 {
+			seq++
+			records := append(history[topic], busRecord{seq: seq, value: received})
+			if len(records) > b.Replay {
+				records = records[1:]
+			}
+			history[topic] = records
+		}
+		targets = targets[:0]
+		for _, subscriber := range subscribers {
+			if matchTopic(subscriber.pattern, topic) {
+				targets = append(targets, subscriber)
+			}
+		}
+		// deliver to each subscriber, still handling commands while we wait
+		deliver := []reflect.SelectCase{
+			DoneChanClosed:  selectConfig[DoneChanClosed],
+			CommandReceived: selectConfig[CommandReceived],
+			FirstSource:     {Dir: reflect.SelectSend, Send: received},
+		}
+		for _, target := range targets {
+			if !target.active {
+				continue // unsubscribed while we delivered to another subscriber
+			}
+			deliver[FirstSource].Chan = target.intake
+			for {
+				caseChosen, command, _ := reflect.Select(deliver)
+				if caseChosen == DoneChanClosed {
+					return
+				} else if caseChosen == FirstSource {
+					break
+				}
+				handle(command.Interface().(busCommand))
+				if !target.active {
+					break
+				}
+			}
+		}
+	}
+}
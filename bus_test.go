@@ -0,0 +1,108 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func receiveString(t *testing.T, out <-chan string) string {
+	select {
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out")
+	case elem, more := <-out:
+		if !more {
+			t.Fatalf("channel closed unexpectedly")
+		}
+		return elem
+	}
+	return ""
+}
+
+func expectNothing(t *testing.T, out <-chan string) {
+	select {
+	case elem := <-out:
+		t.Fatalf("unexpected message %q", elem)
+	case <-time.After(time.Millisecond * 10):
+	}
+}
+
+func TestBusWildcards(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	bus := fan.NewBus(done, reflect.TypeOf(""), fan.BusConfig{Config: fan.Strings(), Buffer: 10})
+	all := bus.Subscribe("orders.>").(<-chan string)
+	created := bus.Subscribe("orders.*.created").(<-chan string)
+	us := bus.Subscribe("orders.us.*").(<-chan string)
+	exact := bus.Subscribe("orders.eu.created").(<-chan string)
+
+	publishers := bus.Publishers("orders.eu.created", 2)
+	publishers[0].(chan<- string) <- "first"
+	publishers[1].(chan<- string) <- "second"
+	// the two publishers are independent, so their messages may arrive in either order
+	for _, subscription := range []<-chan string{all, created, exact} {
+		received := map[string]bool{receiveString(t, subscription): true, receiveString(t, subscription): true}
+		if !received["first"] || !received["second"] {
+			t.Fatalf("expected first and second, got %v", received)
+		}
+	}
+	cancelled := bus.Publisher("orders.eu.cancelled").(chan<- string)
+	cancelled <- "third"
+	if elem := receiveString(t, all); elem != "third" {
+		t.Fatalf("expected third, got %q", elem)
+	}
+	expectNothing(t, created)
+	expectNothing(t, us)
+
+	if !bus.Unsubscribe(all) {
+		t.Fatalf("subscription should have been active")
+	}
+	if _, more := <-all; more {
+		t.Fatalf("subscription should close after unsubscribing")
+	}
+	cancelled <- "fourth"
+	if bus.Unsubscribe(all) {
+		t.Fatalf("subscription should already be cancelled")
+	}
+	if bus.Unsubscribe(nil) {
+		t.Fatalf("nil is not a subscription")
+	}
+}
+
+func TestBusReplay(t *testing.T) {
+	done := make(chan struct{})
+	bus := fan.NewBus(done, reflect.TypeOf(""), fan.BusConfig{Replay: 2})
+	a := bus.Publisher("a").(chan<- string)
+	b := bus.Publisher("b").(chan<- string)
+	// wait for each message to be broadcast, so that they are retained in a known order
+	published := bus.Subscribe(">").(<-chan string)
+	for _, publish := range []struct {
+		publisher chan<- string
+		elem      string
+	}{{a, "a1"}, {b, "b1"}, {a, "a2"}, {a, "a3"}} {
+		publish.publisher <- publish.elem
+		receiveString(t, published)
+	}
+	bus.Unsubscribe(published)
+
+	late := bus.Subscribe("*").(<-chan string)
+	for _, expected := range []string{"b1", "a2", "a3"} {
+		if elem := receiveString(t, late); elem != expected {
+			t.Fatalf("expected %q, got %q", expected, elem)
+		}
+	}
+	b <- "b2"
+	if elem := receiveString(t, late); elem != "b2" {
+		t.Fatalf("expected live message b2, got %q", elem)
+	}
+	close(done)
+	for range late {
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command fangen generates fan-in Configs specialized to the named types, so that fanning
+// them in avoids reflection without hand-writing a SelectFunc for each one. It is meant to be
+// run with go:generate from the package that defines the types:
+//
+//	//go:generate fangen -type=OrderCreated,OrderCancelled,*Invoice
+//
+// For each type T it writes a constructor TConfig returning a fan.Config whose SelectFunc is
+// specialized to T, and a typed wrapper FanInT that accepts and returns channels of T without
+// type assertions. Unexported types get unexported functions. With -register, it also writes
+// an init function that registers each SelectFunc with fan.Register, so that even fan.Config{}
+// uses them.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/build"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+func main() {
+	var (
+		typeNames   string
+		packageName string
+		outputName  string
+		register    bool
+	)
+	flag.StringVar(&typeNames, "type", "", "Comma-separated list of type names; prefix a name with * for a pointer type")
+	flag.StringVar(&packageName, "package", "", "The package name of the generated file (defaults to the package in the current directory)")
+	flag.StringVar(&outputName, "output", "fan_gen.go", "The name of the output file")
+	flag.BoolVar(&register, "register", false, "Register each SelectFunc with fan.Register in an init function")
+	flag.Parse()
+	if typeNames == "" {
+		log.Fatalf("must provide at least one type with -type")
+	}
+	if packageName == "" {
+		pkg, err := build.ImportDir(".", 0)
+		if err != nil {
+			log.Fatalf("failed finding the package in the current directory (use -package): %v", err)
+		}
+		packageName = pkg.Name
+	}
+	source, err := generate(packageName, strings.Split(typeNames, ","), register, os.Args[1:])
+	if err != nil {
+		log.Fatalf("failed generating code: %v", err)
+	}
+	if err := ioutil.WriteFile(outputName, source, 0644); err != nil {
+		log.Fatalf("failed writing %s: %v", outputName, err)
+	}
+}
+
+// generatedType describes the code generated for one type.
+type generatedType struct {
+	// Type is the type as written in Go source, such as *Invoice
+	Type string
+	// Config and FanIn are the names of the generated functions
+	Config, FanIn string
+}
+
+// newGeneratedType names the functions generated for typeName.
+func newGeneratedType(typeName string) (generatedType, error) {
+	typeName = strings.TrimSpace(typeName)
+	name := strings.TrimPrefix(typeName, "*")
+	if !isIdentifier(name) {
+		return generatedType{}, fmt.Errorf("%q is not a type name", typeName)
+	}
+	if name != typeName {
+		name += "Ptr"
+	}
+	t := generatedType{Type: typeName, Config: name + "Config", FanIn: "FanIn" + upperFirst(name)}
+	if first, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(first) {
+		t.FanIn = "fanIn" + upperFirst(name)
+	}
+	return t, nil
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func upperFirst(name string) string {
+	first, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(first)) + name[size:]
+}
+
+var generated = template.Must(template.New("generated").Parse(`// Code generated by "fangen {{.Args}}"; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	fan "github.com/IBM/fast-fan-in"
+)
+{{range .Types}}
+// {{.Config}} returns a config intended to fan-in channels with {{.Type}}
+// as their element type.
+func {{.Config}}() fan.Config {
+	return fan.Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan {{.Type}}):
+				if !more {
+					return true
+				}
+				out.(chan {{.Type}}) <- element
+			}
+			return false
+		},
+	}
+}
+
+// {{.FanIn}} fans in channels of {{.Type}} using config, which defaults to
+// {{.Config}}() if it has no SelectFunc. See fan.Config.FanIn.
+func {{.FanIn}}(config fan.Config, done <-chan struct{}, channels ...<-chan {{.Type}}) <-chan {{.Type}} {
+	if config.SelectFunc == nil {
+		config.SelectFunc = {{.Config}}().SelectFunc
+	}
+	inputs := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		inputs[i] = channel
+	}
+	return config.FanIn(done, inputs...).(<-chan {{.Type}})
+}
+{{end}}{{if .Register}}
+func init() {
+{{- range .Types}}
+	fan.Register(make(chan {{.Type}}), {{.Config}}().SelectFunc)
+{{- end}}
+}
+{{end}}`))
+
+// generate returns the formatted source of a file in the named package with code for each of
+// the types. args are recorded in the file's header.
+func generate(packageName string, typeNames []string, register bool, args []string) ([]byte, error) {
+	data := struct {
+		Args     string
+		Package  string
+		Types    []generatedType
+		Register bool
+	}{
+		Args:     strings.Join(args, " "),
+		Package:  packageName,
+		Register: register,
+	}
+	for _, typeName := range typeNames {
+		t, err := newGeneratedType(typeName)
+		if err != nil {
+			return nil, err
+		}
+		data.Types = append(data.Types, t)
+	}
+	var buf bytes.Buffer
+	if err := generated.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,69 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	source, err := generate("orders", []string{"OrderCreated", " *Invoice", "lineItem"}, true, []string{"-type=OrderCreated,*Invoice,lineItem", "-register"})
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if !strings.HasPrefix(string(source), `// Code generated by "fangen -type=OrderCreated,*Invoice,lineItem -register"; DO NOT EDIT.`) {
+		t.Errorf("missing generated code header:\n%s", source)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "fan_gen.go", source, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, source)
+	}
+	if file.Name.Name != "orders" {
+		t.Errorf("expected package orders, got %s", file.Name.Name)
+	}
+	var funcs []string
+	for _, decl := range file.Decls {
+		if f, ok := decl.(*ast.FuncDecl); ok {
+			funcs = append(funcs, f.Name.Name)
+		}
+	}
+	expected := []string{
+		"OrderCreatedConfig", "FanInOrderCreated",
+		"InvoicePtrConfig", "FanInInvoicePtr",
+		"lineItemConfig", "fanInLineItem",
+		"init",
+	}
+	if !reflect.DeepEqual(funcs, expected) {
+		t.Errorf("expected functions %v, got %v", expected, funcs)
+	}
+	if !strings.Contains(string(source), "<-in.(<-chan *Invoice)") {
+		t.Errorf("SelectFunc for *Invoice does not assert its input type:\n%s", source)
+	}
+}
+
+func TestGenerateWithoutRegister(t *testing.T) {
+	source, err := generate("orders", []string{"OrderCreated"}, false, nil)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if strings.Contains(string(source), "func init()") {
+		t.Errorf("generated an init function without -register:\n%s", source)
+	}
+}
+
+func TestGenerateInvalidType(t *testing.T) {
+	for _, typeName := range []string{"", "[]int", "map[string]int", "pkg.Type", "**Invoice", "1st"} {
+		if _, err := generate("orders", []string{typeName}, false, nil); err == nil {
+			t.Errorf("expected an error for type %q", typeName)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"reflect"
+	"time"
+)
+
+// EnvelopeConfig configures how a fan-in wraps elements in Envelopes.
+type EnvelopeConfig struct {
+	// SequenceID, if set, returns the sequence number that the upstream producer assigned
+	// to an element. Each input's IDs are expected to increase by one from element to
+	// element, and the fan-in reports any gaps or duplicates in its Envelopes and Stats.
+	SequenceID func(elem interface{}) uint64
+}
+
+// Envelope is an element wrapped with information about where and when a fan-in received it.
+type Envelope struct {
+	// Value is the element that was received.
+	Value interface{}
+	// Input is the index of the channel (as passed to FanIn) that Value was received from.
+	Input int
+	// Seq is the position of Value among the elements received from its input, starting at 1.
+	Seq uint64
+	// Received is when the fan-in received Value from its input.
+	Received time.Time
+	// Sent is when the fan-in began sending the envelope on the output channel. The time
+	// between Received and Sent was spent waiting behind other elements.
+	Sent time.Time
+	// WALSeq is the sequence number that the Config's WAL assigned to Value, which can be
+	// passed to WAL.Commit once Value has been processed. It is zero if the Config has no WAL
+	// or Value could not be appended to it.
+	WALSeq uint64
+
+	// SourceID is the sequence number assigned by the upstream producer, as reported by
+	// EnvelopeConfig.SequenceID. It and the fields below are zero if SequenceID is not set.
+	SourceID uint64
+	// Missing is the number of sequence numbers skipped between the previous element
+	// received from the same input and this one.
+	Missing uint64
+	// Duplicate is true if SourceID is not greater than the highest one previously received
+	// from the same input.
+	Duplicate bool
+}
+
+var envelopeType = reflect.TypeOf(Envelope{})
+
+func (c Config) tagEnvelope(input int) func(reflect.Value) reflect.Value {
+	var (
+		seq     uint64
+		highest uint64
+	)
+	sequenceID := c.Envelope.SequenceID
+	return func(elem reflect.Value) reflect.Value {
+		if !elem.IsValid() {
+			return reflect.Value{}
+		}
+		seq++
+		envelope := Envelope{
+			Value:    elem.Interface(),
+			Input:    input,
+			Seq:      seq,
+			Received: time.Now(),
+		}
+		if sequenceID != nil {
+			envelope.SourceID = sequenceID(envelope.Value)
+			switch {
+			case seq > 1 && envelope.SourceID <= highest:
+				envelope.Duplicate = true
+				c.Stats.addDuplicates(1)
+			case seq > 1 && envelope.SourceID > highest+1:
+				envelope.Missing = envelope.SourceID - highest - 1
+				c.Stats.addMissing(envelope.Missing)
+			}
+			if envelope.SourceID > highest || seq == 1 {
+				highest = envelope.SourceID
+			}
+		}
+		return reflect.ValueOf(envelope)
+	}
+}
+
+// stamp sets the Sent time of each envelope received on in and sends it on out. It closes out
+// when in closes or done closes.
+func stamp(done <-chan struct{}, in <-chan Envelope, out chan<- Envelope) {
+	defer close(out)
+	for {
+		select {
+		case <-done:
+			go drain(reflect.ValueOf(in))
+			return
+		case envelope, more := <-in:
+			if !more {
+				return
+			}
+			envelope.Sent = time.Now()
+			select {
+			case <-done:
+				go drain(reflect.ValueOf(in))
+				return
+			case out <- envelope:
+			}
+		}
+	}
+}
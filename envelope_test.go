@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestEnvelopeSources(t *testing.T) {
+	a, b := make(chan string), make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	config := fan.Strings()
+	config.Envelope = &fan.EnvelopeConfig{}
+	out := config.FanIn(done, a, b).(<-chan fan.Envelope)
+	go func() {
+		defer close(a)
+		a <- "a1"
+		a <- "a2"
+	}()
+	go func() {
+		defer close(b)
+		b <- "b1"
+	}()
+	seen := make(map[string]fan.Envelope)
+	for envelope := range out {
+		seen[envelope.Value.(string)] = envelope
+		if envelope.Received.IsZero() || envelope.Sent.Before(envelope.Received) {
+			t.Fatalf("bad timestamps on %+v", envelope)
+		}
+	}
+	for value, expected := range map[string]struct {
+		input int
+		seq   uint64
+	}{"a1": {0, 1}, "a2": {0, 2}, "b1": {1, 1}} {
+		envelope, ok := seen[value]
+		if !ok {
+			t.Fatalf("never received %s", value)
+		}
+		if envelope.Input != expected.input || envelope.Seq != expected.seq {
+			t.Fatalf("expected %s to be element %d from input %d, got %+v", value, expected.seq, expected.input, envelope)
+		}
+	}
+}
+
+func TestEnvelopeGapsAndDuplicates(t *testing.T) {
+	in := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	stats := &fan.Stats{}
+	config := fan.Config{
+		Envelope: &fan.EnvelopeConfig{
+			SequenceID: func(elem interface{}) uint64 { return uint64(elem.(int)) },
+		},
+		Stats: stats,
+	}
+	out := config.FanIn(done, in).(<-chan fan.Envelope)
+	go func() {
+		defer close(in)
+		for _, id := range []int{10, 11, 14, 12, 15} {
+			in <- id
+		}
+	}()
+	var missing []int
+	var duplicates []int
+	for {
+		select {
+		case <-time.NewTicker(time.Millisecond * 10).C:
+			t.Fatalf("timed out")
+		case envelope, more := <-out:
+			if !more {
+				expectInts(t, []int{0, 0, 2, 0, 0}, missing)
+				expectInts(t, []int{12}, duplicates)
+				if stats.Missing() != 2 || stats.Duplicates() != 1 {
+					t.Fatalf("expected 2 missing and 1 duplicate, got %d and %d", stats.Missing(), stats.Duplicates())
+				}
+				return
+			}
+			missing = append(missing, int(envelope.Missing))
+			if envelope.Duplicate {
+				duplicates = append(duplicates, int(envelope.SourceID))
+			}
+		}
+	}
+}
+
+func TestEnvelopeWithAck(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatalf("should have panicked combining Envelope and Ack")
+		}
+	}()
+	config := fan.Config{Envelope: &fan.EnvelopeConfig{}, Ack: &fan.AckConfig{}}
+	config.FanIn(make(chan struct{}), make(chan int))
+}
@@ -0,0 +1,213 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"container/heap"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// EventTimeConfig configures an event-time merge.
+type EventTimeConfig struct {
+	// Timestamp returns the event time of an element. It is required, and is called
+	// concurrently from the goroutines handling each input.
+	Timestamp func(elem interface{}) time.Time
+
+	// AllowedLateness is how far out of order the elements of a single input may be. Each
+	// input's watermark trails the latest event time it has produced by this much.
+	AllowedLateness time.Duration
+}
+
+// timedElem is an element received by an event-time merge, or a notice that an input closed.
+type timedElem struct {
+	input  int
+	at     time.Time
+	value  reflect.Value
+	closed bool
+}
+
+var timedElemType = reflect.TypeOf(timedElem{})
+
+// MergeEventTime fans in channels whose elements carry event times, and emits them on merged
+// in event-time order. The channels must follow the same rules as for FanIn, and both returned
+// values are receive-only channels of their element type that must be type-asserted by the
+// caller.
+//
+// Each input has a watermark: the latest event time it has produced, less the allowed
+// lateness. Elements are held until the minimum watermark across all open inputs reaches their
+// event time, so an input that has not produced anything holds back the whole merge. An element
+// whose event time is already behind the minimum watermark when it arrives cannot be emitted in
+// order, so it is sent on late instead. The caller must receive from both channels.
+//
+// Both channels close when all inputs have closed and every held element has been emitted, or
+// when done closes. This will panic under the same conditions as FanIn, or if the config has
+// no Timestamp function.
+func (c Config) MergeEventTime(done <-chan struct{}, events EventTimeConfig, channels ...interface{}) (merged, late interface{}) {
+	if events.Timestamp == nil {
+		panic(fmt.Errorf("MergeEventTime() called without a Timestamp function"))
+	}
+	c.tag, c.tagType = events.tag, timedElemType
+	in := c.FanIn(done, channels...).(<-chan timedElem)
+	elementType := reflect.TypeOf(channels[0]).Elem()
+	ordered := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elementType), 0)
+	behind := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elementType), 0)
+	go events.order(done, in, len(channels), ordered, behind)
+	recvType := reflect.ChanOf(reflect.RecvDir, elementType)
+	return ordered.Convert(recvType).Interface(), behind.Convert(recvType).Interface()
+}
+
+func (e EventTimeConfig) tag(input int) func(reflect.Value) reflect.Value {
+	return func(elem reflect.Value) reflect.Value {
+		if !elem.IsValid() {
+			return reflect.ValueOf(timedElem{input: input, closed: true})
+		}
+		return reflect.ValueOf(timedElem{
+			input: input,
+			at:    e.Timestamp(elem.Interface()),
+			value: elem,
+		})
+	}
+}
+
+// eventHeap holds elements waiting for the watermark, earliest first. Elements with the same
+// event time stay in arrival order.
+type eventHeap []heldEvent
+
+type heldEvent struct {
+	at      time.Time
+	arrival uint64
+	value   reflect.Value
+}
+
+func (h eventHeap) Len() int { return len(h) }
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].arrival < h[j].arrival
+	}
+	return h[i].at.Before(h[j].at)
+}
+func (h eventHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *eventHeap) Push(x interface{}) { *h = append(*h, x.(heldEvent)) }
+func (h *eventHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// order emits the elements received on in to merged in event-time order, and late elements to
+// late. It closes both when in closes and everything has been emitted, or when done closes.
+func (e EventTimeConfig) order(done <-chan struct{}, in <-chan timedElem, numInputs int, merged, late reflect.Value) {
+	defer merged.Close()
+	defer late.Close()
+	const (
+		DoneChanClosed = 0
+		InputChanRead  = 1
+		MergedChanSent = 2
+		LateChanSent   = 3
+	)
+	var (
+		input      = reflect.ValueOf(in)
+		held       eventHeap
+		arrivals   uint64
+		ready      []reflect.Value // elements that have passed the watermark, in order
+		behind     []reflect.Value // late elements
+		watermarks = make([]time.Time, numInputs)
+		started    = make([]bool, numInputs)
+		closed     = make([]bool, numInputs)
+		open       = numInputs
+		// watermark is the minimum of the inputs' watermarks. It never moves backwards.
+		watermark    time.Time
+		hasWatermark bool
+	)
+	// advance recomputes the minimum watermark and releases every held element it has passed
+	advance := func() {
+		var (
+			min   time.Time
+			found bool
+		)
+		for i := range watermarks {
+			if closed[i] {
+				continue
+			}
+			if !started[i] {
+				return // an input with no watermark holds everything back
+			}
+			if !found || watermarks[i].Before(min) {
+				min, found = watermarks[i], true
+			}
+		}
+		if found && (!hasWatermark || min.After(watermark)) {
+			watermark, hasWatermark = min, true
+		}
+		for held.Len() > 0 && (open == 0 || !held[0].at.After(watermark)) {
+			ready = append(ready, heap.Pop(&held).(heldEvent).value)
+		}
+	}
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		InputChanRead:  {Dir: reflect.SelectRecv},
+		MergedChanSent: {Dir: reflect.SelectSend},
+		LateChanSent:   {Dir: reflect.SelectSend},
+	}
+	for {
+		if !input.IsValid() && len(ready) == 0 && len(behind) == 0 {
+			return
+		}
+		// only take new input once everything we can emit has been emitted
+		selectConfig[InputChanRead].Chan = reflect.Value{}
+		if len(ready) == 0 && len(behind) == 0 {
+			selectConfig[InputChanRead].Chan = input
+		}
+		selectConfig[MergedChanSent].Chan, selectConfig[MergedChanSent].Send = reflect.Value{}, reflect.Value{}
+		if len(ready) > 0 {
+			selectConfig[MergedChanSent].Chan, selectConfig[MergedChanSent].Send = merged, ready[0]
+		}
+		selectConfig[LateChanSent].Chan, selectConfig[LateChanSent].Send = reflect.Value{}, reflect.Value{}
+		if len(behind) > 0 {
+			selectConfig[LateChanSent].Chan, selectConfig[LateChanSent].Send = late, behind[0]
+		}
+		switch caseChosen, recv, more := reflect.Select(selectConfig); caseChosen {
+		case DoneChanClosed:
+			if input.IsValid() {
+				go drain(input)
+			}
+			return
+		case InputChanRead:
+			if !more {
+				// every input has closed, so release everything still held
+				input = reflect.Value{}
+				open = 0
+				advance()
+				continue
+			}
+			elem := recv.Interface().(timedElem)
+			if elem.closed {
+				closed[elem.input] = true
+				open--
+				advance()
+				continue
+			}
+			if hasWatermark && elem.at.Before(watermark) {
+				behind = append(behind, elem.value)
+				continue
+			}
+			arrivals++
+			heap.Push(&held, heldEvent{at: elem.at, arrival: arrivals, value: elem.value})
+			if mark := elem.at.Add(-e.AllowedLateness); !started[elem.input] || mark.After(watermarks[elem.input]) {
+				watermarks[elem.input], started[elem.input] = mark, true
+			}
+			advance()
+		case MergedChanSent:
+			ready = ready[1:]
+		case LateChanSent:
+			behind = behind[1:]
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+// eventTimes treats integer elements as event times in seconds.
+var eventTimes = fan.EventTimeConfig{
+	Timestamp: func(elem interface{}) time.Time {
+		return time.Unix(int64(elem.(int)), 0)
+	},
+}
+
+func TestMergeEventTimeOrders(t *testing.T) {
+	a, b, c := make(chan int), make(chan int), make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	config := eventTimes
+	config.AllowedLateness = time.Second
+	merged, late := fan.Ints().MergeEventTime(done, config, a, b, c)
+	send := func(in chan int, times ...int) {
+		defer close(in)
+		for _, at := range times {
+			in <- at
+		}
+	}
+	// within the allowed lateness, each input may be slightly out of order
+	go send(a, 1, 4, 3, 7)
+	go send(b, 2, 5, 8)
+	go send(c, 6, 9)
+	go func() {
+		for elem := range late.(<-chan int) {
+			t.Errorf("unexpected late element %d", elem)
+		}
+	}()
+	expectInts(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, receiveAll(t, merged.(<-chan int)))
+}
+
+func TestMergeEventTimeLate(t *testing.T) {
+	a, b := make(chan int), make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	merged, late := fan.Config{}.MergeEventTime(done, eventTimes, a, b)
+	ordered, behind := merged.(<-chan int), late.(<-chan int)
+	a <- 5
+	b <- 6
+	// the watermark is now 5, so 5 can be emitted
+	select {
+	case <-time.NewTicker(time.Millisecond * 10).C:
+		t.Fatalf("timed out")
+	case elem := <-ordered:
+		if elem != 5 {
+			t.Fatalf("expected 5, got %d", elem)
+		}
+	}
+	b <- 2
+	select {
+	case <-time.NewTicker(time.Millisecond * 10).C:
+		t.Fatalf("timed out")
+	case elem := <-behind:
+		if elem != 2 {
+			t.Fatalf("expected 2 to be late, got %d", elem)
+		}
+	}
+	close(a)
+	close(b)
+	expectInts(t, []int{6}, receiveAll(t, ordered))
+	if _, more := <-behind; more {
+		t.Fatalf("late channel is not closed after inputs closed")
+	}
+}
+
+func TestMergeEventTimeHeldByIdleInput(t *testing.T) {
+	a, b := make(chan int), make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	merged, _ := fan.Ints().MergeEventTime(done, eventTimes, a, b)
+	a <- 1
+	select {
+	case elem := <-merged.(<-chan int):
+		t.Fatalf("should not emit %d before every input has a watermark", elem)
+	case <-time.NewTicker(time.Millisecond * 10).C:
+	}
+	close(b)
+	select {
+	case <-time.NewTicker(time.Millisecond * 10).C:
+		t.Fatalf("timed out")
+	case elem := <-merged.(<-chan int):
+		if elem != 1 {
+			t.Fatalf("expected 1, got %d", elem)
+		}
+	}
+}
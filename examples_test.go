@@ -8,10 +8,12 @@ package fan_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	fan "github.com/IBM/fast-fan-in"
 )
@@ -50,7 +52,8 @@ func ExampleInts() {
 	// we allocate this as a slice of interface because otherwise we'd need to cast
 	// a []chan int into a []interface{}. Go doesn't allow this as a direct type-cast,
 	// so we'd need to allocate a second slice of type []interface{} and copy each
-	// element. This is more concise
+	// element. This is more concise. If you already have a []chan T, FanInSlice
+	// accepts it directly
 	workerOuts := make([]interface{}, numWorkers)
 	for i := 0; i < numWorkers; i++ {
 		workerOuts[i] = double(ints) // this returns the output channel of the worker
@@ -110,7 +113,8 @@ func ExampleStrings() {
 	// we allocate this as a slice of interface because otherwise we'd need to cast
 	// a []chan string into a []interface{}. Go doesn't allow this as a direct type-cast,
 	// so we'd need to allocate a second slice of type []interface{} and copy each
-	// element. This is more concise
+	// element. This is more concise. If you already have a []chan T, FanInSlice
+	// accepts it directly
 	workerOuts := make([]interface{}, numWorkers)
 	for i := 0; i < numWorkers; i++ {
 		workerOuts[i] = concat(strs) // this returns the output channel of the worker
@@ -677,3 +681,200 @@ func ExampleUintptrs() {
 		[2 3 5 7]
 	*/
 }
+
+func ExampleErrors() {
+	a, b := make(chan error), make(chan error)
+	go func() {
+		defer close(a)
+		defer close(b)
+		a <- errors.New("a failed")
+		b <- errors.New("b failed")
+		a <- errors.New("a failed again")
+		b <- errors.New("b failed again")
+	}()
+
+	done := make(chan struct{})
+	out := fan.Errors().FanIn(done, a, b).(<-chan error)
+
+	var results []string
+	for result := range out {
+		results = append(results, result.Error())
+	}
+
+	sort.Strings(results)
+	fmt.Println(strings.Join(results, ", "))
+	/*
+		Output:
+		a failed, a failed again, b failed, b failed again
+	*/
+}
+
+func ExampleEmptyStructs() {
+	a, b := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(a)
+		defer close(b)
+		a <- struct{}{}
+		b <- struct{}{}
+		a <- struct{}{}
+		b <- struct{}{}
+	}()
+
+	done := make(chan struct{})
+	out := fan.EmptyStructs().FanIn(done, a, b).(<-chan struct{})
+
+	signals := 0
+	for range out {
+		signals++
+	}
+
+	fmt.Println(signals)
+	/*
+		Output:
+		4
+	*/
+}
+
+func ExampleTimes() {
+	a, b := make(chan time.Time), make(chan time.Time)
+	start := time.Date(2020, time.January, 1, 9, 0, 0, 0, time.UTC)
+	go func() {
+		defer close(a)
+		defer close(b)
+		a <- start
+		b <- start.Add(time.Hour)
+		a <- start.Add(2 * time.Hour)
+		b <- start.Add(3 * time.Hour)
+	}()
+
+	done := make(chan struct{})
+	out := fan.Times().FanIn(done, a, b).(<-chan time.Time)
+
+	var results []time.Time
+	for result := range out {
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Before(results[j])
+	})
+	var formatted []string
+	for _, result := range results {
+		formatted = append(formatted, result.Format(time.Kitchen))
+	}
+	fmt.Println(formatted)
+	/*
+		Output:
+		[9:00AM 10:00AM 11:00AM 12:00PM]
+	*/
+}
+
+func ExampleDurations() {
+	a, b := make(chan time.Duration), make(chan time.Duration)
+	go func() {
+		defer close(a)
+		defer close(b)
+		a <- time.Second
+		b <- 2 * time.Second
+		a <- 3 * time.Second
+		b <- 4 * time.Second
+	}()
+
+	done := make(chan struct{})
+	out := fan.Durations().FanIn(done, a, b).(<-chan time.Duration)
+
+	var results []time.Duration
+	for result := range out {
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i] < results[j]
+	})
+	fmt.Println(results)
+	/*
+		Output:
+		[1s 2s 3s 4s]
+	*/
+}
+
+func ExampleStringSlices() {
+	a, b := make(chan []string), make(chan []string)
+	go func() {
+		defer close(a)
+		defer close(b)
+		a <- []string{"hello", "world"}
+		b <- []string{"here's", "an"}
+		a <- []string{"example"}
+	}()
+
+	done := make(chan struct{})
+	out := fan.StringSlices().FanIn(done, a, b).(<-chan []string)
+
+	var results [][]string
+	for result := range out {
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i][0] < results[j][0]
+	})
+	fmt.Println(results)
+	/*
+		Output:
+		[[example] [hello world] [here's an]]
+	*/
+}
+
+func ExampleStringInterfaceMaps() {
+	a, b := make(chan map[string]interface{}), make(chan map[string]interface{})
+	go func() {
+		defer close(a)
+		defer close(b)
+		a <- map[string]interface{}{"id": 1, "kind": "created"}
+		b <- map[string]interface{}{"id": 2, "kind": "created"}
+		a <- map[string]interface{}{"id": 3, "kind": "cancelled"}
+	}()
+
+	done := make(chan struct{})
+	out := fan.StringInterfaceMaps().FanIn(done, a, b).(<-chan map[string]interface{})
+
+	var results []map[string]interface{}
+	for result := range out {
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i]["id"].(int) < results[j]["id"].(int)
+	})
+	fmt.Println(results)
+	/*
+		Output:
+		[map[id:1 kind:created] map[id:2 kind:created] map[id:3 kind:cancelled]]
+	*/
+}
+
+// When the channels are already in a slice of a channel type, FanInSlice accepts it without
+// copying it into a []interface{}:
+func ExampleConfig_FanInSlice() {
+	workers := make([]chan int, 3)
+	for i := range workers {
+		workers[i] = make(chan int, 1)
+		workers[i] <- i * i
+		close(workers[i])
+	}
+
+	done := make(chan struct{})
+	out := fan.Ints().FanInSlice(done, workers).(<-chan int)
+
+	var results []int
+	for result := range out {
+		results = append(results, result)
+	}
+	sort.Ints(results)
+	fmt.Println(results)
+	/*
+		Output:
+		[0 1 4]
+	*/
+}
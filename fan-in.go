@@ -65,8 +65,8 @@ the element type of the channels in the two type assertions.
 
 
 If your use-case is not performance-critical, we also provide a reflection-based fallback
-implementation which is used when no SelectFunc is provided. See [benchmarks](#benchmarks)
-to understand the performance effect of this implementation.
+implementation which is used when no SelectFunc is provided or registered (see Register).
+See [benchmarks](#benchmarks) to understand the performance effect of this implementation.
 
 To use the inefficient reflection-based approach on a custom type, you can do:
 
@@ -91,6 +91,7 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 )
 
 // Interfaces returns a config intended to fan-in channels with the empty interface
@@ -492,6 +493,120 @@ func Uint64s() Config {
 	}
 }
 
+// Errors returns a config intended to fan-in channels with error
+// as their element type.
+func Errors() Config {
+	return Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan error):
+				if !more {
+					return true
+				}
+				out.(chan error) <- element
+			}
+			return false
+		},
+	}
+}
+
+// EmptyStructs returns a config intended to fan-in channels with struct{}
+// as their element type.
+func EmptyStructs() Config {
+	return Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan struct{}):
+				if !more {
+					return true
+				}
+				out.(chan struct{}) <- element
+			}
+			return false
+		},
+	}
+}
+
+// Times returns a config intended to fan-in channels with time.Time
+// as their element type.
+func Times() Config {
+	return Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan time.Time):
+				if !more {
+					return true
+				}
+				out.(chan time.Time) <- element
+			}
+			return false
+		},
+	}
+}
+
+// Durations returns a config intended to fan-in channels with time.Duration
+// as their element type.
+func Durations() Config {
+	return Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan time.Duration):
+				if !more {
+					return true
+				}
+				out.(chan time.Duration) <- element
+			}
+			return false
+		},
+	}
+}
+
+// StringSlices returns a config intended to fan-in channels with []string
+// as their element type.
+func StringSlices() Config {
+	return Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan []string):
+				if !more {
+					return true
+				}
+				out.(chan []string) <- element
+			}
+			return false
+		},
+	}
+}
+
+// StringInterfaceMaps returns a config intended to fan-in channels with map[string]interface{}
+// as their element type.
+func StringInterfaceMaps() Config {
+	return Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan map[string]interface{}):
+				if !more {
+					return true
+				}
+				out.(chan map[string]interface{}) <- element
+			}
+			return false
+		},
+	}
+}
+
 // SelectFunc is a function that implements the core logic of a fan-in implementation for a particular
 // type. They should contain a single select statement that listens on the `done`
 // channel and the `in` channel. They must type-assert the `in` channel to be a
@@ -519,14 +634,77 @@ type SelectFunc func(done <-chan struct{}, in, out interface{}) (shouldStop bool
 // Config is the configuration for fanning in channels of a particular element type.
 type Config struct {
 	// SelectFunc is a function that (if set) will be used to listen on a channel and
-	// send data on another channel. If it is not provided, a reflect-based default
-	// will be used. This has a significant performance penalty, but it will work for
-	// all types.
+	// send data on another channel. If it is not provided, the SelectFunc registered for
+	// the channels' element type (see Register) is used, and if there is none, a
+	// reflect-based default will be used. This has a significant performance penalty,
+	// but it will work for all types.
 	//
 	// To properly implement a SelectFunc, you must specialize it to the type of data
 	// that you will be fanning over the channels. See the docs on the SelectFunc type
 	// for examples
 	SelectFunc
+
+	// QueueSize, if positive, places a queue that can hold this many elements between
+	// the workers and the output channel. Without a queue, the output channel is
+	// unbuffered and a slow consumer stalls every input. Note that each worker may also
+	// hold one element that it has received but not yet handed to the queue.
+	QueueSize int
+
+	// Overflow determines what happens to elements that arrive while the queue is full.
+	// It has no effect unless QueueSize is positive, or if Spill is set.
+	Overflow OverflowPolicy
+
+	// HighWater is the queue length at which the Shed policy starts its timer. If it is
+	// not positive, QueueSize is used.
+	HighWater int
+
+	// ShedAfter is how long the queue must remain at or above HighWater before the Shed
+	// policy begins dropping incoming elements.
+	ShedAfter time.Duration
+
+	// Spill, if set, lets the queue grow beyond QueueSize elements by writing the excess
+	// to segment files on disk and reading them back in order as the consumer catches up.
+	// It has no effect unless QueueSize is positive.
+	Spill *SpillConfig
+
+	// WAL, if set, is a write-ahead log to which every element received by the workers is
+	// appended before it is queued or delivered. Set Envelope as well to learn the sequence
+	// number of each delivered element. See the WAL type for details.
+	WAL *WAL
+
+	// Ack, if set, switches the fan-in to at-least-once delivery. The output channel will
+	// have *Delivery as its element type, and elements that the consumer does not acknowledge
+	// are delivered again. See AckConfig for details. Ack cannot be combined with WAL, Spill,
+	// or Envelope.
+	Ack *AckConfig
+
+	// Envelope, if set, wraps each element in an Envelope describing where and when it was
+	// received, so the output channel will have Envelope as its element type. Envelope cannot
+	// be combined with Spill or Ack.
+	Envelope *EnvelopeConfig
+
+	// Stats, if set, will be updated with counters describing the fan-in operation.
+	Stats *Stats
+
+	// Watchdog, if set, reports workers that have been blocked sending for too long, or whose
+	// inputs have been idle for too long. See WatchdogConfig.
+	Watchdog *WatchdogConfig
+
+	// Recover, if set, recovers panics in the workers (for example, from a SelectFunc with the
+	// wrong type assertion) instead of letting them crash the process. See RecoverConfig.
+	Recover *RecoverConfig
+
+	// Pool, if set, runs the workers on goroutines kept from earlier fan-ins instead of
+	// starting new ones. See Pool.
+	Pool *Pool
+
+	// tag, if set, wraps elements in values of tagType. It lets operators built on FanIn
+	// find out which input each element came from.
+	tag     tagger
+	tagType reflect.Type
+
+	// batch, if set, makes the workers move elements in batches. See Batched.
+	batch batcher
 }
 
 // reflectiveSelectFunc is the default implementation of the Fan's SelectFunc. It expects
@@ -572,10 +750,23 @@ func reflectiveSelectFunc(done <-chan struct{}, in, out interface{}) (shouldStop
 // This will panic if no channels are provided, if values other than channels are provided,
 // if send-only channels are provided, or if the provided channels are the not
 // the same element type (though a mixture of receive-only and bidirectional channels with the
-// same element type is fine).
+// same element type is fine). It will also panic if the config is batched for another element
+// type, or if a Spill is configured and its directory cannot be created. The SelectFunc is not
+// checked against the channels' element type (see Validate).
 func (c Config) FanIn(done <-chan struct{}, channels ...interface{}) interface{} {
+	elementType := checkChannels("concurrent.FanIn", channels)
+	if err := c.checkBatch(elementType); err != nil {
+		panic(err)
+	}
+	c.SelectFunc = c.selectFunc(elementType)
+	return c.fanIn(done, elementType, c.workers(channels))
+}
+
+// checkChannels makes sure that there is at least one channel, and that the channels all
+// support receive and have the same element type, which it returns.
+func checkChannels(operation string, channels []interface{}) reflect.Type {
 	if len(channels) < 1 {
-		panic(fmt.Errorf("concurrent.FanIn() called with no channels provided"))
+		panic(fmt.Errorf("%s() called with no channels provided", operation))
 	}
 	elementType := reflect.TypeOf(nil)
 	// make sure all channels are the same type and are actually channels
@@ -599,34 +790,276 @@ func (c Config) FanIn(done <-chan struct{}, channels ...interface{}) interface{}
 			panic(fmt.Errorf("channels[%d] has element type %v, which does not match previous element type %v", i, t.Elem(), elementType))
 		}
 	}
-	output := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elementType), 0)
+	return elementType
+}
+
+// workers returns a worker for each channel that uses the config's SelectFunc.
+func (c Config) workers(channels []interface{}) []worker {
+	workers := make([]worker, len(channels))
+	for i, channel := range channels {
+		workers[i] = worker{channel: channel, loopBody: c.SelectFunc}
+	}
+	return workers
+}
+
+// worker describes how elements are moved from one input channel to the fan-in's output.
+type worker struct {
+	channel  interface{}
+	loopBody SelectFunc
+	// inputType, if set, is the receive-only type of channel, saving the worker from
+	// looking it up
+	inputType reflect.Type
+	// reflective is set if loopBody expects its channels as reflect.Values, like
+	// reflectiveSelectFunc does
+	reflective bool
+}
+
+// fanIn runs the workers, which send elements of elementType, and builds the stages that
+// carry their elements to the returned output channel.
+func (c Config) fanIn(done <-chan struct{}, elementType reflect.Type, workers []worker) interface{} {
+	p := c.pipeline(done, elementType)
+	// make sure we close the channel our workers send on once they have all finished
+	c.run(done, p, workers, p.close)
+	return p.output
+}
+
+// pipeline carries the elements sent by a fan-in's workers to its output.
+type pipeline struct {
+	elementType reflect.Type
+	// sink is the channel that the workers send on (after wrapping, if tag is set). It must be
+	// closed once every worker has finished.
+	sink reflect.Value
+	tag  tagger
+	// output is the receive-only output channel
+	output interface{}
+	// recover, if set, recovers panics in the workers, and stopper stops them all after one
+	// panics if the config asks for that
+	recover *RecoverConfig
+	stopper *stopper
+	// watch, if set, is told about every worker's progress
+	watch *watchdog
+	// pool, if set, runs the workers
+	pool *Pool
+}
+
+// close must be called once every worker has finished. It closes the sink.
+func (p pipeline) close() {
+	p.watch.stop()
+	p.sink.Close()
+}
+
+// outputType returns the element type of the output of a fan-in whose inputs have elementType,
+// and the tagger that wraps elements if it differs.
+func (c Config) outputType(elementType reflect.Type) (reflect.Type, tagger) {
+	// elements may be wrapped with information about the input they came from, in which case
+	// everything downstream of the workers carries the wrapper type instead
+	outputType, tag := elementType, c.tag
+	if c.tag != nil {
+		outputType = c.tagType
+	}
+	if c.batch != nil && c.tag != nil {
+		panic(fmt.Errorf("batched configs cannot be combined with operators that wrap elements"))
+	}
+	if c.tag != nil || c.Ack != nil || c.Envelope != nil {
+		if c.Spill != nil || (c.Ack != nil && (c.Envelope != nil || c.WAL != nil)) || (c.tag != nil && (c.Ack != nil || c.Envelope != nil || c.WAL != nil)) {
+			panic(fmt.Errorf("Ack and Envelope cannot be combined with each other, Spill, or operators that wrap elements, and Ack cannot be combined with WAL"))
+		}
+	}
+	if c.Ack != nil {
+		outputType, tag = deliveryType, c.Ack.tag
+	} else if c.Envelope != nil {
+		outputType, tag = envelopeType, c.tagEnvelope
+	}
+	return outputType, tag
+}
+
+// staged reports whether the config puts any stages between a fan-in's workers and its output.
+func (c Config) staged() bool {
+	return c.Envelope != nil || c.Ack != nil || c.QueueSize > 0 || c.WAL != nil
+}
+
+// pipeline builds the stages between the workers of a fan-in, which send elements of
+// elementType, and its output.
+func (c Config) pipeline(done <-chan struct{}, elementType reflect.Type) pipeline {
+	outputType, tag := c.outputType(elementType)
+	// a batched fan-in's output has room for a batch, so that the consumer can receive a
+	// batch's elements without waiting for each one to be sent
+	capacity := 0
+	if c.batch != nil {
+		capacity = c.batch.size()
+	}
+	output := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, outputType), capacity)
+	// workers send directly to the output unless stages are configured between them. Each
+	// stage reads from a new channel and feeds the one after it, so we build them back to front.
+	sink := output
+	if c.Envelope != nil {
+		intake := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, outputType), 0)
+		go stamp(done, intake.Interface().(chan Envelope), output.Interface().(chan Envelope))
+		sink = intake
+	}
+	if c.Ack != nil {
+		intake := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, outputType), 0)
+		go c.Ack.manage(done, intake.Interface().(chan *Delivery), output.Interface().(chan *Delivery))
+		sink = intake
+	}
+	if c.QueueSize > 0 {
+		var disk *spill
+		if c.Spill != nil {
+			var err error
+			if disk, err = c.Spill.open(elementType); err != nil {
+				panic(err)
+			}
+		}
+		intake := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, outputType), 0)
+		go c.queue(done, intake, sink, disk)
+		sink = intake
+	}
+	if c.WAL != nil {
+		// the WAL logs the elements inside envelopes, and records their sequence numbers
+		intake := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, outputType), 0)
+		go c.WAL.log(done, intake, sink, c.Envelope != nil)
+		sink = intake
+	}
+	// return output as receive-only
+	return pipeline{
+		elementType: elementType,
+		sink:        sink,
+		tag:         tag,
+		output:      output.Convert(reflect.ChanOf(reflect.RecvDir, outputType)).Interface(),
+		recover:     c.Recover,
+		stopper:     c.stopper(),
+		watch:       c.watchdog(done),
+		pool:        c.Pool,
+	}
+}
+
+// stopper returns a stopper for the workers of a fan-in if they should all stop after one
+// panics, or nil.
+func (c Config) stopper() *stopper {
+	if c.Recover == nil || !c.Recover.StopAll {
+		return nil
+	}
+	return &stopper{stopped: make(chan struct{})}
+}
+
+// run starts a worker for each input, and calls finished once they have all stopped sending.
+func (p pipeline) run(done <-chan struct{}, workers []worker, finished func()) {
 	var wg sync.WaitGroup
-	wg.Add(len(channels))
+	wg.Add(len(workers))
 
 	// launch a worker goroutine for each input channel
-	for _, channel := range channels {
-		go func(loopBody SelectFunc, done <-chan struct{}, inChan, outChan interface{}) {
-			// ensure that the inChan to each fan-in worker is receive-only
-			inChan = reflect.ValueOf(inChan).Convert(reflect.ChanOf(reflect.RecvDir, elementType)).Interface()
-			// if no select function provided, fall back on a reflection-based implementation
-			if loopBody == nil {
-				loopBody = reflectiveSelectFunc
-				inChan = reflect.ValueOf(inChan)
-				outChan = reflect.ValueOf(outChan)
-			}
-			defer wg.Done()
-			for {
-				if loopBody(done, inChan, outChan) {
-					break
-				}
-			}
-		}(c.SelectFunc, done, channel, output.Interface())
+	for i, w := range workers {
+		p.start(done, i, w, wg.Done)
 	}
-	// make sure we close our output channel when our waitgroup finishes
-	go func() {
-		defer output.Close()
+	p.pool.run(func() {
+		defer finished()
 		wg.Wait()
-	}()
-	// return output as receive-only
-	return output.Convert(reflect.ChanOf(reflect.RecvDir, elementType)).Interface()
+	})
+}
+
+// start launches a goroutine that runs the worker for the given input, calling finished once
+// it has stopped sending.
+func (p pipeline) start(done <-chan struct{}, input int, w worker, finished func()) {
+	// when wrapping, each worker sends to its own channel, and a tagging goroutine wraps
+	// the elements and sends them on to the sink
+	target := p.sink
+	if p.tag != nil {
+		target = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, p.elementType), 0)
+		go p.tag.run(done, input, target, p.sink, finished)
+		finished = target.Close
+	}
+	// with a watchdog, each worker's elements are relayed through a goroutine that records
+	// its progress
+	if p.watch != nil {
+		watched := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, p.elementType), 0)
+		go p.watch.relay(done, input, watched, target, finished)
+		target, finished = watched, watched.Close
+	}
+	outChan := target.Interface()
+	p.pool.run(func() {
+		p.work(done, input, w, outChan, finished)
+	})
+}
+
+// work runs the worker for the given input until it stops, then calls finished.
+func (p pipeline) work(done <-chan struct{}, input int, w worker, outChan interface{}, finished func()) {
+	// ensure that the inChan to each fan-in worker is receive-only
+	in := reflect.ValueOf(w.channel)
+	if w.inputType == nil {
+		w.inputType = reflect.ChanOf(reflect.RecvDir, in.Type().Elem())
+	}
+	inChan := w.channel
+	if in.Type() != w.inputType {
+		inChan = in.Convert(w.inputType).Interface()
+	}
+	// if no select function provided, fall back on a reflection-based implementation
+	if w.loopBody == nil {
+		w.loopBody, w.reflective = reflectiveSelectFunc, true
+	}
+	if w.reflective {
+		inChan = reflect.ValueOf(inChan)
+		outChan = reflect.ValueOf(outChan)
+	}
+	defer finished()
+	if p.recover != nil {
+		defer p.recover.handle(input, p.stopper)
+	}
+	if p.stopper != nil {
+		var release func()
+		done, release = p.stopper.guard(done)
+		defer release()
+	}
+	for {
+		if w.loopBody(done, inChan, outChan) {
+			break
+		}
+	}
+}
+
+// tagger returns a function that wraps the elements received from the input at the given
+// index. The returned function is only ever called from one goroutine, so it may keep state
+// about its input. When the input closes, it is called once more with the zero Value, and if
+// it returns a valid Value that is sent as well.
+type tagger func(input int) func(elem reflect.Value) reflect.Value
+
+// run wraps each element received on in and sends it on out, calling finished once in closes.
+func (tag tagger) run(done <-chan struct{}, input int, in, out reflect.Value, finished func()) {
+	defer finished()
+	wrap := tag(input)
+	const (
+		DoneChanClosed = 0
+		OutputChanSent = 1
+	)
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		OutputChanSent: {Dir: reflect.SelectSend, Chan: out},
+	}
+	for {
+		elem, more := in.Recv()
+		if !more {
+			elem = reflect.Value{}
+		}
+		wrapped := wrap(elem)
+		if !more && !wrapped.IsValid() {
+			return
+		}
+		selectConfig[OutputChanSent].Send = wrapped
+		if caseChosen, _, _ := reflect.Select(selectConfig); caseChosen == DoneChanClosed {
+			// keep receiving so that our worker isn't stuck sending to us
+			drain(in)
+			return
+		} else if !more {
+			return
+		}
+	}
+}
+
+// drain receives and discards elements from in until it closes. Stages call it when done
+// closes so that goroutines upstream of them can always finish sending and exit.
+func drain(in reflect.Value) {
+	for {
+		if _, more := in.Recv(); !more {
+			return
+		}
+	}
 }
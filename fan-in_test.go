@@ -6,7 +6,9 @@ SPDX-License-Identifier: Apache-2.0
 package fan_test
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"sort"
 	"sync"
 	"testing"
@@ -184,15 +186,19 @@ func FanInMultipleClose(t *testing.T, numChannels, max int) {
 	}
 }
 
+// benchInt is the element type used by the benchmarks. It has no registered SelectFunc, so
+// fan.Config{} really does fall back to reflection for it.
+type benchInt int
+
 // This is an efficient implementation of FanIn for a concrete type. It is used to
 // compare the efficiency of the type-agnostic implementation defined in this package
 // against a type-specific implementation.
-func ConcreteFanIn(done <-chan struct{}, inputs ...<-chan int) <-chan int {
-	results := make(chan int)
+func ConcreteFanIn(done <-chan struct{}, inputs ...<-chan benchInt) <-chan benchInt {
+	results := make(chan benchInt)
 	var wg sync.WaitGroup
 	// define a function to accept input on a single channel and push it onto the
 	// shared channel that we return
-	fan := func(input <-chan int) {
+	fan := func(input <-chan benchInt) {
 		defer wg.Done()
 		for {
 			select {
@@ -221,8 +227,8 @@ func ConcreteFanIn(done <-chan struct{}, inputs ...<-chan int) <-chan int {
 }
 
 func BenchmarkFanIn(b *testing.B) {
-	setupConcrete := func(inputs []chan int) (chan<- struct{}, <-chan int) {
-		asRcvOnly := make([]<-chan int, len(inputs))
+	setupConcrete := func(inputs []chan benchInt) (chan<- struct{}, <-chan benchInt) {
+		asRcvOnly := make([]<-chan benchInt, len(inputs))
 		for i := range inputs {
 			asRcvOnly[i] = inputs[i]
 		}
@@ -230,16 +236,16 @@ func BenchmarkFanIn(b *testing.B) {
 		output := ConcreteFanIn(done, asRcvOnly...)
 		return done, output
 	}
-	setupHybridUnspecialized := func(inputs []chan int) (chan<- struct{}, <-chan int) {
+	setupHybridUnspecialized := func(inputs []chan benchInt) (chan<- struct{}, <-chan benchInt) {
 		asGeneric := make([]interface{}, len(inputs))
 		for i := range inputs {
 			asGeneric[i] = inputs[i]
 		}
 		done := make(chan struct{})
-		output := fan.Config{}.FanIn(done, asGeneric...).(<-chan int)
+		output := fan.Config{}.FanIn(done, asGeneric...).(<-chan benchInt)
 		return done, output
 	}
-	setupHybridSpecialized := func(inputs []chan int) (chan<- struct{}, <-chan int) {
+	setupHybridSpecialized := func(inputs []chan benchInt) (chan<- struct{}, <-chan benchInt) {
 		asGeneric := make([]interface{}, len(inputs))
 		for i := range inputs {
 			asGeneric[i] = inputs[i]
@@ -250,19 +256,19 @@ func BenchmarkFanIn(b *testing.B) {
 				select {
 				case <-done:
 					return true
-				case element, more := <-in.(<-chan int):
+				case element, more := <-in.(<-chan benchInt):
 					if !more {
 						return true
 					}
-					out.(chan int) <- element
+					out.(chan benchInt) <- element
 				}
 				return false
 			},
 		}
-		output := fan.FanIn(done, asGeneric...).(<-chan int)
+		output := fan.FanIn(done, asGeneric...).(<-chan benchInt)
 		return done, output
 	}
-	type setupFunc func(inputs []chan int) (chan<- struct{}, <-chan int)
+	type setupFunc func(inputs []chan benchInt) (chan<- struct{}, <-chan benchInt)
 	type implDetails struct {
 		Name  string
 		Setup setupFunc
@@ -275,9 +281,9 @@ func BenchmarkFanIn(b *testing.B) {
 				{Name: "hybrid-closure", Setup: setupHybridSpecialized},
 			} {
 				b.Run(fmt.Sprintf("chans:%d,elems:%d,impl:%s", numChannels, numElements, setup.Name), func(b *testing.B) {
-					inputs := make([]chan int, numChannels)
+					inputs := make([]chan benchInt, numChannels)
 					for i := range inputs {
-						inputs[i] = make(chan int, numElements/numChannels+(numElements%numChannels))
+						inputs[i] = make(chan benchInt, numElements/numChannels+(numElements%numChannels))
 					}
 					done, output := setup.Setup(inputs)
 					defer close(done)
@@ -285,7 +291,7 @@ func BenchmarkFanIn(b *testing.B) {
 					for i := 0; i < b.N; i++ {
 						go func() {
 							for i := 0; i < numElements; i++ {
-								inputs[i%len(inputs)] <- i
+								inputs[i%len(inputs)] <- benchInt(i)
 							}
 						}()
 						for i := 0; i < numElements; i++ {
@@ -298,6 +304,217 @@ func BenchmarkFanIn(b *testing.B) {
 	}
 }
 
+// reflectSelectFunc moves elements of any type with reflection. It is the baseline that
+// BenchmarkStdlibConfigs compares the built-in configs with.
+func reflectSelectFunc(done <-chan struct{}, in, out interface{}) bool {
+	const (
+		DoneChanClosed = 0
+		InputChanRead  = 1
+		OutputChanSent = 1
+	)
+	chosen, element, more := reflect.Select([]reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		InputChanRead:  {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(in)},
+	})
+	if chosen == DoneChanClosed || !more {
+		return true
+	}
+	chosen, _, _ = reflect.Select([]reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		OutputChanSent: {Dir: reflect.SelectSend, Chan: reflect.ValueOf(out), Send: element},
+	})
+	return chosen == DoneChanClosed
+}
+
+// BenchmarkStdlibConfigs measures the built-in configs for common standard library types
+// against reflectSelectFunc. Elements are sent and received with typed channel operations, so
+// that only the fan-in's cost differs between them.
+func BenchmarkStdlibConfigs(b *testing.B) {
+	const numChannels, numElements = 10, 1000
+	sampleErr := errors.New("sample")
+	now := time.Now()
+	sampleSlice := []string{"sample"}
+	sampleMap := map[string]interface{}{"sample": 1}
+	for _, config := range []struct {
+		Name   string
+		Config fan.Config
+		// Chan makes an input channel, and Send and Recv send a sample element on one and
+		// receive an element from the output
+		Chan func() interface{}
+		Send func(input interface{})
+		Recv func(output interface{})
+	}{
+		{
+			Name: "Errors", Config: fan.Errors(),
+			Chan: func() interface{} { return make(chan error, numElements/numChannels) },
+			Send: func(input interface{}) { input.(chan error) <- sampleErr },
+			Recv: func(output interface{}) { <-output.(<-chan error) },
+		},
+		{
+			Name: "EmptyStructs", Config: fan.EmptyStructs(),
+			Chan: func() interface{} { return make(chan struct{}, numElements/numChannels) },
+			Send: func(input interface{}) { input.(chan struct{}) <- struct{}{} },
+			Recv: func(output interface{}) { <-output.(<-chan struct{}) },
+		},
+		{
+			Name: "Times", Config: fan.Times(),
+			Chan: func() interface{} { return make(chan time.Time, numElements/numChannels) },
+			Send: func(input interface{}) { input.(chan time.Time) <- now },
+			Recv: func(output interface{}) { <-output.(<-chan time.Time) },
+		},
+		{
+			Name: "Durations", Config: fan.Durations(),
+			Chan: func() interface{} { return make(chan time.Duration, numElements/numChannels) },
+			Send: func(input interface{}) { input.(chan time.Duration) <- time.Second },
+			Recv: func(output interface{}) { <-output.(<-chan time.Duration) },
+		},
+		{
+			Name: "StringSlices", Config: fan.StringSlices(),
+			Chan: func() interface{} { return make(chan []string, numElements/numChannels) },
+			Send: func(input interface{}) { input.(chan []string) <- sampleSlice },
+			Recv: func(output interface{}) { <-output.(<-chan []string) },
+		},
+		{
+			Name: "StringInterfaceMaps", Config: fan.StringInterfaceMaps(),
+			Chan: func() interface{} { return make(chan map[string]interface{}, numElements/numChannels) },
+			Send: func(input interface{}) { input.(chan map[string]interface{}) <- sampleMap },
+			Recv: func(output interface{}) { <-output.(<-chan map[string]interface{}) },
+		},
+	} {
+		for _, impl := range []struct {
+			Name   string
+			Config fan.Config
+		}{
+			{Name: "config", Config: config.Config},
+			{Name: "reflect", Config: fan.Config{SelectFunc: reflectSelectFunc}},
+		} {
+			b.Run(config.Name+"/"+impl.Name, func(b *testing.B) {
+				inputs := make([]interface{}, numChannels)
+				for i := range inputs {
+					inputs[i] = config.Chan()
+				}
+				done := make(chan struct{})
+				defer close(done)
+				output := impl.Config.FanIn(done, inputs...)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					go func() {
+						for i := 0; i < numElements; i++ {
+							config.Send(inputs[i%len(inputs)])
+						}
+					}()
+					for i := 0; i < numElements; i++ {
+						config.Recv(output)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkShortLived measures fan-ins of a few channels that each carry a single element,
+// where setting up the fan-in costs more than moving the elements.
+func BenchmarkShortLived(b *testing.B) {
+	const numChannels = 3
+	pool := fan.NewPool(64)
+	defer pool.Close()
+	pooled := fan.Ints()
+	pooled.Pool = pool
+	for _, impl := range []struct {
+		Name  string
+		FanIn func(done <-chan struct{}, channels ...interface{}) interface{}
+	}{
+		{Name: "fan-in", FanIn: fan.Ints().FanIn},
+		{Name: "plan", FanIn: fan.Ints().Plan(make(chan int), numChannels).FanIn},
+		{Name: "plan-pool", FanIn: pooled.Plan(make(chan int), numChannels).FanIn},
+	} {
+		b.Run(impl.Name, func(b *testing.B) {
+			done := make(chan struct{})
+			defer close(done)
+			inputs := make([]interface{}, numChannels)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := range inputs {
+					input := make(chan int, 1)
+					input <- j
+					close(input)
+					inputs[j] = input
+				}
+				for range impl.FanIn(done, inputs...).(<-chan int) {
+				}
+			}
+		})
+	}
+}
+
+// deepSelect is a SelectFunc for ints whose work needs a deep stack, as with a recursive
+// parser or a large library call.
+func deepSelect(done <-chan struct{}, in, out interface{}) bool {
+	select {
+	case <-done:
+		return true
+	case e, more := <-in.(<-chan int):
+		if !more {
+			return true
+		}
+		select {
+		case <-done:
+			return true
+		case out.(chan int) <- e + recurse(200):
+		}
+	}
+	return false
+}
+
+// recurse uses about 256 bytes of stack per level.
+//
+//go:noinline
+func recurse(depth int) int {
+	var frame [256]byte
+	frame[depth%len(frame)] = byte(depth)
+	if depth == 0 {
+		return int(frame[0])
+	}
+	return recurse(depth-1) + int(frame[depth%len(frame)])
+}
+
+// BenchmarkDeepWorkers is BenchmarkShortLived with workers that grow their stacks. A new
+// goroutine grows its stack again on every fan-in, while a pooled one keeps the stack it grew,
+// so this is where a Pool pays for its handoff.
+func BenchmarkDeepWorkers(b *testing.B) {
+	const numChannels = 3
+	pool := fan.NewPool(64)
+	defer pool.Close()
+	for _, impl := range []struct {
+		Name string
+		Pool *fan.Pool
+	}{
+		{Name: "plan"},
+		{Name: "plan-pool", Pool: pool},
+	} {
+		config := fan.Config{SelectFunc: deepSelect, Pool: impl.Pool}
+		plan := config.Plan(make(chan int), numChannels)
+		b.Run(impl.Name, func(b *testing.B) {
+			done := make(chan struct{})
+			defer close(done)
+			inputs := make([]interface{}, numChannels)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := range inputs {
+					input := make(chan int, 1)
+					input <- j
+					close(input)
+					inputs[j] = input
+				}
+				for range plan.FanIn(done, inputs...).(<-chan int) {
+				}
+			}
+		})
+	}
+}
+
 // Here's a simple example of doubling integers using the fan-out, fan-in
 // pattern:
 func ExampleConfig() {
@@ -0,0 +1,20 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command fanfix migrates type-asserted FanIn calls to the typed FanInStream API. Without
+// flags it lists the calls that it would rewrite; with -fix it rewrites them in place:
+//
+//	fanfix -fix ./...
+package main
+
+import (
+	"github.com/IBM/fast-fan-in/fanvet/fanfix"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(fanfix.Analyzer)
+}
@@ -0,0 +1,19 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command fanvet runs the fanvet analyzer, either on its own or as a vet tool:
+//
+//	go vet -vettool=$(which fanvet) ./...
+package main
+
+import (
+	"github.com/IBM/fast-fan-in/fanvet"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(fanvet.Analyzer)
+}
@@ -0,0 +1,389 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package fanfix defines an analyzer that migrates calls of Config.FanIn whose result is
+// type-asserted to a channel type, such as
+//
+//	fan.Ints().FanIn(done, a, b).(<-chan int)
+//
+// to the typed API:
+//
+//	fan.FanInStream[int](fan.Ints(), done, a, b).C()
+//
+// When the channels are passed through a []interface{} built just before the call, by
+// copying a slice of channels with a range loop, the loop and the slice are removed and the
+// slice of channels is passed instead.
+//
+// A call is only rewritten when that is known to be safe: every channel argument must have a
+// static channel type with the asserted element type, the result must be asserted directly
+// and not with comma-ok, and the file must be compiled with a Go version that supports
+// generics. Anything else is left untouched and not reported.
+package fanfix
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"go/version"
+	"strconv"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// fanPath is the import path of the fan-in package.
+const fanPath = "github.com/IBM/fast-fan-in"
+
+// Analyzer reports calls of FanIn that can use FanInStream, with fixes that rewrite them.
+var Analyzer = &analysis.Analyzer{
+	Name:     "fanfix",
+	Doc:      "rewrite type-asserted FanIn calls to use the typed FanInStream",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	var fan *types.Package
+	for _, imported := range pass.Pkg.Imports() {
+		if imported.Path() == fanPath {
+			fan = imported
+		}
+	}
+	if fan == nil || fan.Scope().Lookup("FanInStream") == nil {
+		return nil, nil
+	}
+	var file *ast.File
+	nodes := []ast.Node{(*ast.File)(nil), (*ast.TypeAssertExpr)(nil)}
+	pass.ResultOf[inspect.Analyzer].(*inspector.Inspector).WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		switch n := n.(type) {
+		case *ast.File:
+			file = n
+		case *ast.TypeAssertExpr:
+			if fix, ok := rewrite(pass, file, n, stack); ok {
+				pass.Report(analysis.Diagnostic{
+					Pos:            n.Pos(),
+					End:            n.End(),
+					Message:        "FanIn with a type-asserted result can use FanInStream",
+					SuggestedFixes: []analysis.SuggestedFix{fix},
+				})
+			}
+		}
+		return true
+	})
+	return nil, nil
+}
+
+// rewrite returns the fix that replaces assert, the assertion at the top of stack, with a
+// call of FanInStream, or false if the assertion is not on the result of FanIn or cannot be
+// rewritten safely.
+func rewrite(pass *analysis.Pass, file *ast.File, assert *ast.TypeAssertExpr, stack []ast.Node) (analysis.SuggestedFix, bool) {
+	var fix analysis.SuggestedFix
+	fileVersion := pass.TypesInfo.FileVersions[file]
+	if fileVersion != "" && version.Compare(fileVersion, "go1.18") < 0 {
+		return fix, false
+	}
+	pkgName := importName(file)
+	if pkgName == "" {
+		return fix, false
+	}
+	call, ok := assert.X.(*ast.CallExpr)
+	if !ok || assert.Type == nil || isCommaOk(stack) {
+		return fix, false
+	}
+	selector, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) < 2 || !isFanInMethod(pass, selector) {
+		return fix, false
+	}
+	chanType, ok := assert.Type.(*ast.ChanType)
+	if !ok || chanType.Dir != ast.RECV {
+		return fix, false
+	}
+	elem := pass.TypesInfo.TypeOf(chanType.Value)
+	if elem == nil {
+		return fix, false
+	}
+	elemText := source(pass, chanType.Value)
+
+	// FanIn(done, a, b).(<-chan T) becomes FanInStream[T](config, done, a, b).C(), keeping
+	// the receiver and arguments as they are
+	fix.Message = "Use FanInStream"
+	fix.TextEdits = []analysis.TextEdit{
+		{Pos: selector.X.Pos(), End: selector.X.Pos(), NewText: []byte(pkgName + ".FanInStream[" + elemText + "](")},
+		{Pos: selector.X.End(), End: call.Lparen + 1, NewText: []byte(", ")},
+		{Pos: call.End(), End: assert.End(), NewText: []byte(".C()")},
+	}
+	if !call.Ellipsis.IsValid() {
+		for _, arg := range call.Args[1:] {
+			channel, ok := pass.TypesInfo.TypeOf(arg).Underlying().(*types.Chan)
+			if !ok || channel.Dir() == types.SendOnly || !types.Identical(channel.Elem(), elem) {
+				return fix, false
+			}
+		}
+		return fix, true
+	}
+	if len(call.Args) != 2 {
+		return fix, false
+	}
+	shim, ok := findShim(pass, call.Args[1], elem, stack)
+	if !ok {
+		return fix, false
+	}
+	fix.TextEdits = append(fix.TextEdits,
+		analysis.TextEdit{Pos: shim.decl.Pos(), End: shim.next.Pos()},
+		analysis.TextEdit{Pos: call.Args[1].Pos(), End: call.Args[1].End(), NewText: []byte(source(pass, shim.channels))},
+	)
+	return fix, true
+}
+
+// importName returns the name by which file refers to the fan-in package, or "" if it does
+// not import it by name.
+func importName(file *ast.File) string {
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != fanPath {
+			continue
+		}
+		if spec.Name == nil {
+			return "fan"
+		}
+		if spec.Name.Name == "_" || spec.Name.Name == "." {
+			return ""
+		}
+		return spec.Name.Name
+	}
+	return ""
+}
+
+// isCommaOk reports whether the assertion at the top of stack is assigned to two values.
+func isCommaOk(stack []ast.Node) bool {
+	switch parent := stack[len(stack)-2].(type) {
+	case *ast.AssignStmt:
+		return len(parent.Lhs) == 2
+	case *ast.ValueSpec:
+		return len(parent.Names) == 2
+	}
+	return false
+}
+
+// isFanInMethod reports whether selector is Config.FanIn called on a Config value. Calls on
+// a *Config, or on a type that embeds Config, are not, since FanInStream takes a Config.
+func isFanInMethod(pass *analysis.Pass, selector *ast.SelectorExpr) bool {
+	method, ok := pass.TypesInfo.Uses[selector.Sel].(*types.Func)
+	if !ok || method.Pkg() == nil || method.Pkg().Path() != fanPath || method.Name() != "FanIn" {
+		return false
+	}
+	recv := method.Type().(*types.Signature).Recv()
+	named, ok := recv.Type().(*types.Named)
+	if !ok || named.Obj().Name() != "Config" {
+		return false
+	}
+	x := pass.TypesInfo.TypeOf(selector.X)
+	return x != nil && types.Identical(x, named)
+}
+
+// shim is a []interface{} of channels built just before the statement that passes it to
+// FanIn.
+type shim struct {
+	// decl declares the slice, next is the statement after the loop that fills it, and
+	// channels is the slice of channels that the loop copies
+	decl, next ast.Stmt
+	channels   ast.Expr
+}
+
+// findShim matches arg, which is passed to FanIn with ..., against a shim of one of these
+// forms, which must immediately precede the statement containing the call:
+//
+//	inputs := make([]interface{}, len(channels))
+//	for i, channel := range channels {
+//		inputs[i] = channel
+//	}
+//
+//	var inputs []interface{}
+//	for _, channel := range channels {
+//		inputs = append(inputs, channel)
+//	}
+//
+// The slice must not be used anywhere else, and channels must be assignable to []<-chan T.
+func findShim(pass *analysis.Pass, arg ast.Expr, elem types.Type, stack []ast.Node) (shim, bool) {
+	ident, ok := arg.(*ast.Ident)
+	if !ok {
+		return shim{}, false
+	}
+	inputs := pass.TypesInfo.Uses[ident]
+	if inputs == nil {
+		return shim{}, false
+	}
+	// find the statement containing the call, and the two before it
+	var block *ast.BlockStmt
+	var stmt ast.Stmt
+	for i := len(stack) - 2; i >= 0 && block == nil; i-- {
+		if b, ok := stack[i].(*ast.BlockStmt); ok {
+			block, stmt = b, stack[i+1].(ast.Stmt)
+		}
+	}
+	if block == nil {
+		return shim{}, false
+	}
+	index := -1
+	for i, s := range block.List {
+		if s == stmt {
+			index = i
+		}
+	}
+	if index < 2 {
+		return shim{}, false
+	}
+	decl, loop := block.List[index-2], block.List[index-1]
+	rangeStmt, ok := loop.(*ast.RangeStmt)
+	if !ok || len(rangeStmt.Body.List) != 1 {
+		return shim{}, false
+	}
+	channels, ok := rangeStmt.X.(*ast.Ident)
+	if !ok || pass.TypesInfo.Uses[channels] == nil {
+		return shim{}, false
+	}
+	if !types.AssignableTo(pass.TypesInfo.TypeOf(channels), types.NewSlice(types.NewChan(types.RecvOnly, elem))) {
+		return shim{}, false
+	}
+	var uses int
+	switch length := declaredLength(pass, decl, inputs); {
+	case length == nil:
+		return shim{}, false
+	case isLen(pass, length, channels):
+		uses = 2
+		if !isIndexCopy(pass, rangeStmt, inputs, channels) {
+			return shim{}, false
+		}
+	case isZero(length):
+		uses = 3
+		if !isAppendCopy(pass, rangeStmt, inputs) {
+			return shim{}, false
+		}
+	default:
+		return shim{}, false
+	}
+	for _, obj := range pass.TypesInfo.Uses {
+		if obj == inputs {
+			uses--
+		}
+	}
+	if uses != 0 {
+		return shim{}, false
+	}
+	return shim{decl: decl, next: stmt, channels: channels}, true
+}
+
+// declaredLength returns the initial length of inputs if decl declares it as a []interface{}
+// and nothing else, or nil if it does not.
+func declaredLength(pass *analysis.Pass, decl ast.Stmt, inputs types.Object) ast.Expr {
+	if !types.Identical(inputs.Type(), types.NewSlice(types.NewInterfaceType(nil, nil))) {
+		return nil
+	}
+	switch decl := decl.(type) {
+	case *ast.AssignStmt:
+		if decl.Tok != token.DEFINE || len(decl.Lhs) != 1 || len(decl.Rhs) != 1 || !is(pass, decl.Lhs[0], inputs) {
+			return nil
+		}
+		switch value := decl.Rhs[0].(type) {
+		case *ast.CallExpr:
+			if builtin, ok := pass.TypesInfo.Uses[identOf(value.Fun)].(*types.Builtin); ok && builtin.Name() == "make" && len(value.Args) >= 2 {
+				return value.Args[1]
+			}
+		case *ast.CompositeLit:
+			if len(value.Elts) == 0 {
+				return &ast.BasicLit{Kind: token.INT, Value: "0"}
+			}
+		}
+	case *ast.DeclStmt:
+		general, ok := decl.Decl.(*ast.GenDecl)
+		if !ok || general.Tok != token.VAR || len(general.Specs) != 1 {
+			return nil
+		}
+		spec := general.Specs[0].(*ast.ValueSpec)
+		if len(spec.Names) == 1 && len(spec.Values) == 0 && pass.TypesInfo.Defs[spec.Names[0]] == inputs {
+			return &ast.BasicLit{Kind: token.INT, Value: "0"}
+		}
+	}
+	return nil
+}
+
+// isIndexCopy reports whether loop is
+//
+//	for i, channel := range channels {
+//		inputs[i] = channel
+//	}
+func isIndexCopy(pass *analysis.Pass, loop *ast.RangeStmt, inputs types.Object, channels *ast.Ident) bool {
+	key, value := identOf(loop.Key), identOf(loop.Value)
+	assign, ok := loop.Body.List[0].(*ast.AssignStmt)
+	if key == nil || value == nil || !ok || assign.Tok != token.ASSIGN || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return false
+	}
+	index, ok := assign.Lhs[0].(*ast.IndexExpr)
+	return ok && is(pass, index.X, inputs) && is(pass, index.Index, pass.TypesInfo.ObjectOf(key)) && is(pass, assign.Rhs[0], pass.TypesInfo.ObjectOf(value))
+}
+
+// isAppendCopy reports whether loop is
+//
+//	for _, channel := range channels {
+//		inputs = append(inputs, channel)
+//	}
+func isAppendCopy(pass *analysis.Pass, loop *ast.RangeStmt, inputs types.Object) bool {
+	value := identOf(loop.Value)
+	assign, ok := loop.Body.List[0].(*ast.AssignStmt)
+	if value == nil || !ok || assign.Tok != token.ASSIGN || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 || !is(pass, assign.Lhs[0], inputs) {
+		return false
+	}
+	call, ok := assign.Rhs[0].(*ast.CallExpr)
+	if !ok || len(call.Args) != 2 || call.Ellipsis.IsValid() {
+		return false
+	}
+	builtin, ok := pass.TypesInfo.Uses[identOf(call.Fun)].(*types.Builtin)
+	return ok && builtin.Name() == "append" && is(pass, call.Args[0], inputs) && is(pass, call.Args[1], pass.TypesInfo.ObjectOf(value))
+}
+
+// isLen reports whether length is len(channels).
+func isLen(pass *analysis.Pass, length ast.Expr, channels *ast.Ident) bool {
+	call, ok := length.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return false
+	}
+	builtin, ok := pass.TypesInfo.Uses[identOf(call.Fun)].(*types.Builtin)
+	return ok && builtin.Name() == "len" && is(pass, call.Args[0], pass.TypesInfo.Uses[channels])
+}
+
+// isZero reports whether length is the literal 0.
+func isZero(length ast.Expr) bool {
+	literal, ok := length.(*ast.BasicLit)
+	return ok && literal.Kind == token.INT && literal.Value == "0"
+}
+
+// is reports whether expr is an identifier referring to obj.
+func is(pass *analysis.Pass, expr ast.Expr, obj types.Object) bool {
+	ident := identOf(expr)
+	return ident != nil && obj != nil && pass.TypesInfo.ObjectOf(ident) == obj
+}
+
+// identOf returns expr if it is an identifier other than _, or nil.
+func identOf(expr ast.Expr) *ast.Ident {
+	if ident, ok := expr.(*ast.Ident); ok && ident.Name != "_" {
+		return ident
+	}
+	return nil
+}
+
+// source formats expr as it would appear in the file.
+func source(pass *analysis.Pass, expr ast.Expr) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, pass.Fset, expr); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
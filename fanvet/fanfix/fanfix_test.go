@@ -0,0 +1,18 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fanfix_test
+
+import (
+	"testing"
+
+	"github.com/IBM/fast-fan-in/fanvet/fanfix"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), fanfix.Analyzer, "migrate")
+}
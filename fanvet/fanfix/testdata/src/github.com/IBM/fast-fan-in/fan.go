@@ -0,0 +1,16 @@
+// Package fan is a stand-in for the fan-in package with the declarations that fanfix uses.
+package fan
+
+type Config struct{}
+
+func Ints() Config { return Config{} }
+
+func (c Config) FanIn(done <-chan struct{}, channels ...interface{}) interface{} { return nil }
+
+type Stream[T any] struct{}
+
+func (s *Stream[T]) C() <-chan T { return nil }
+
+func FanInStream[T any](c Config, done <-chan struct{}, channels ...<-chan T) *Stream[T] {
+	return nil
+}
@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func direct(done <-chan struct{}, a, b chan int, c <-chan int) <-chan int {
+	return fan.Ints().FanIn(done, a, b, c).(<-chan int) // want `FanIn with a type-asserted result can use FanInStream`
+}
+
+func config(done <-chan struct{}, config fan.Config, a <-chan []string) {
+	out := config.FanIn(done, a).(<-chan []string) // want `FanIn with a type-asserted result can use FanInStream`
+	for range out {
+	}
+}
+
+func indexShim(done <-chan struct{}, channels []<-chan int) <-chan int {
+	inputs := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		inputs[i] = channel
+	}
+	return fan.Ints().FanIn(done, inputs...).(<-chan int) // want `FanIn with a type-asserted result can use FanInStream`
+}
+
+func appendShim(done <-chan struct{}, channels []<-chan int) <-chan int {
+	var inputs []interface{}
+	for _, channel := range channels {
+		inputs = append(inputs, channel)
+	}
+	merged := fan.Ints().FanIn(done, inputs...).(<-chan int) // want `FanIn with a type-asserted result can use FanInStream`
+	return merged
+}
+
+// the rest are left alone
+
+func unknownTypes(done <-chan struct{}, a chan int, b interface{}) <-chan int {
+	return fan.Ints().FanIn(done, a, b).(<-chan int)
+}
+
+func wrongElement(done <-chan struct{}, a chan int) <-chan int64 {
+	return fan.Ints().FanIn(done, a).(<-chan int64)
+}
+
+func commaOk(done <-chan struct{}, a chan int) {
+	out, ok := fan.Ints().FanIn(done, a).(<-chan int)
+	_, _ = out, ok
+}
+
+func bidirectional(done <-chan struct{}, channels []chan int) <-chan int {
+	inputs := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		inputs[i] = channel
+	}
+	return fan.Ints().FanIn(done, inputs...).(<-chan int)
+}
+
+func sharedShim(done <-chan struct{}, channels []<-chan int) (<-chan int, []interface{}) {
+	inputs := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		inputs[i] = channel
+	}
+	return fan.Ints().FanIn(done, inputs...).(<-chan int), inputs
+}
+
+func notAdjacent(done <-chan struct{}, channels []<-chan int) <-chan int {
+	inputs := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		inputs[i] = channel
+	}
+	channels = nil
+	return fan.Ints().FanIn(done, inputs...).(<-chan int)
+}
+
+func pointer(done <-chan struct{}, config *fan.Config, a chan int) <-chan int {
+	return config.FanIn(done, a).(<-chan int)
+}
+
+type embedding struct {
+	fan.Config
+}
+
+func embedded(done <-chan struct{}, e embedding, a chan int) <-chan int {
+	return e.FanIn(done, a).(<-chan int)
+}
@@ -0,0 +1,250 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package fanvet defines an analyzer that reports uses of github.com/IBM/fast-fan-in whose
+// channel types are known at compile time to disagree, and which would otherwise only be
+// caught by a panic at run time. It reports:
+//
+//   - SelectFunc literals that assert in and out as channels of different element types, or
+//     with the wrong direction (in is always a <-chan, and out is always a chan)
+//   - FanIn and FanInTo calls whose channel arguments have differing element types, or are
+//     not channels that support receive
+//   - type assertions on the result of FanIn that do not match its inputs' element type
+//
+// Arguments with interface types are not checked, since their types are only known at run
+// time.
+package fanvet
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// fanPath is the import path of the fan-in package.
+const fanPath = "github.com/IBM/fast-fan-in"
+
+// Analyzer reports misuse of the fan-in package.
+var Analyzer = &analysis.Analyzer{
+	Name:     "fanvet",
+	Doc:      "report fan-in channel types that would cause a panic at run time",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// channelArgs maps the methods of Config that are checked to the index of their first
+// channel argument.
+var channelArgs = map[string]int{
+	"FanIn":   1,
+	"FanInTo": 3,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	var fan *types.Package
+	for _, imported := range pass.Pkg.Imports() {
+		if imported.Path() == fanPath {
+			fan = imported
+		}
+	}
+	if fan == nil {
+		return nil, nil
+	}
+	selectFuncType, _ := fan.Scope().Lookup("SelectFunc").(*types.TypeName)
+	nodes := []ast.Node{(*ast.FuncLit)(nil), (*ast.CallExpr)(nil), (*ast.TypeAssertExpr)(nil)}
+	pass.ResultOf[inspect.Analyzer].(*inspector.Inspector).WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			if selectFuncType != nil && types.Identical(pass.TypesInfo.TypeOf(n), selectFuncType.Type().Underlying()) && !isSourceSelectFunc(pass, stack) {
+				checkSelectFunc(pass, n)
+			}
+		case *ast.CallExpr:
+			if name, first, ok := fanInCall(pass, n); ok {
+				checkChannels(pass, name, n.Args[first:])
+			}
+		case *ast.TypeAssertExpr:
+			if call, ok := ast.Unparen(n.X).(*ast.CallExpr); ok && n.Type != nil {
+				if name, first, ok := fanInCall(pass, call); ok && name == "FanIn" {
+					checkResult(pass, n, call.Args[first:])
+				}
+			}
+		}
+		return true
+	})
+	return nil, nil
+}
+
+// isSourceSelectFunc reports whether the function literal at the top of stack is the
+// SelectFunc of a Source, which converts between element types and so may assert in and out
+// differently.
+func isSourceSelectFunc(pass *analysis.Pass, stack []ast.Node) bool {
+	if len(stack) < 3 {
+		return false
+	}
+	field, ok := stack[len(stack)-2].(*ast.KeyValueExpr)
+	if !ok {
+		return false
+	}
+	literal, ok := stack[len(stack)-3].(*ast.CompositeLit)
+	if !ok {
+		return false
+	}
+	if key, ok := field.Key.(*ast.Ident); !ok || key.Name != "SelectFunc" {
+		return false
+	}
+	return isFanType(pass.TypesInfo.TypeOf(literal), "Source")
+}
+
+// checkSelectFunc reports a SelectFunc literal whose assertions on in and out disagree.
+func checkSelectFunc(pass *analysis.Pass, lit *ast.FuncLit) {
+	var params []types.Object
+	for _, field := range lit.Type.Params.List {
+		for _, name := range field.Names {
+			params = append(params, pass.TypesInfo.Defs[name])
+		}
+	}
+	if len(params) != 3 {
+		return
+	}
+	in, out := params[1], params[2]
+	var inElem, outElem types.Type
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		assert, ok := n.(*ast.TypeAssertExpr)
+		if !ok || assert.Type == nil {
+			return true
+		}
+		x, ok := ast.Unparen(assert.X).(*ast.Ident)
+		if !ok {
+			return true
+		}
+		channel, ok := pass.TypesInfo.TypeOf(assert.Type).Underlying().(*types.Chan)
+		if !ok {
+			return true
+		}
+		switch pass.TypesInfo.Uses[x] {
+		case in:
+			if channel.Dir() != types.RecvOnly {
+				pass.Reportf(assert.Type.Pos(), "SelectFunc asserts in as %s, but in is always a receive-only channel (<-chan %s)", types.TypeString(channel, qualifier(pass)), types.TypeString(channel.Elem(), qualifier(pass)))
+			}
+			if inElem == nil {
+				inElem = channel.Elem()
+			}
+		case out:
+			if channel.Dir() != types.SendRecv {
+				pass.Reportf(assert.Type.Pos(), "SelectFunc asserts out as %s, but out is always a bidirectional channel (chan %s)", types.TypeString(channel, qualifier(pass)), types.TypeString(channel.Elem(), qualifier(pass)))
+			}
+			if outElem == nil {
+				outElem = channel.Elem()
+				if inElem != nil && !types.Identical(inElem, outElem) {
+					pass.Reportf(assert.Type.Pos(), "SelectFunc asserts in with element type %s but out with element type %s; both have the fan-in's element type", types.TypeString(inElem, qualifier(pass)), types.TypeString(outElem, qualifier(pass)))
+				}
+			}
+		}
+		return true
+	})
+}
+
+// fanInCall reports whether call is to one of the checked methods of Config, with its
+// channels passed individually, and if so returns the method's name and the index of the
+// first channel argument.
+func fanInCall(pass *analysis.Pass, call *ast.CallExpr) (name string, first int, ok bool) {
+	selector, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok || call.Ellipsis.IsValid() {
+		return "", 0, false
+	}
+	method, ok := pass.TypesInfo.Uses[selector.Sel].(*types.Func)
+	if !ok || method.Pkg() == nil || method.Pkg().Path() != fanPath {
+		return "", 0, false
+	}
+	recv := method.Type().(*types.Signature).Recv()
+	if recv == nil || !isFanType(recv.Type(), "Config") {
+		return "", 0, false
+	}
+	first, ok = channelArgs[method.Name()]
+	if !ok || len(call.Args) < first {
+		return "", 0, false
+	}
+	return method.Name(), first, true
+}
+
+// checkChannels reports the channel arguments of a call to the named method that are not
+// channels that support receive, or whose element type differs from the first channel's.
+func checkChannels(pass *analysis.Pass, name string, args []ast.Expr) {
+	var first types.Type
+	for _, arg := range args {
+		t := pass.TypesInfo.TypeOf(arg)
+		if t == nil || types.IsInterface(t) {
+			continue
+		}
+		channel, ok := t.Underlying().(*types.Chan)
+		switch {
+		case !ok:
+			pass.Reportf(arg.Pos(), "%s called with %s, which is not a channel", name, types.TypeString(t, qualifier(pass)))
+		case channel.Dir() == types.SendOnly:
+			pass.Reportf(arg.Pos(), "%s called with %s, which does not support receive", name, types.TypeString(t, qualifier(pass)))
+		case first == nil:
+			first = channel.Elem()
+		case !types.Identical(first, channel.Elem()):
+			pass.Reportf(arg.Pos(), "%s called with channels of differing element types %s and %s", name, types.TypeString(first, qualifier(pass)), types.TypeString(channel.Elem(), qualifier(pass)))
+		}
+	}
+}
+
+// elementType returns the element type shared by the channel arguments, or nil if it is not
+// known statically.
+func elementType(pass *analysis.Pass, args []ast.Expr) types.Type {
+	var elem types.Type
+	for _, arg := range args {
+		t := pass.TypesInfo.TypeOf(arg)
+		if t == nil || types.IsInterface(t) {
+			continue
+		}
+		channel, ok := t.Underlying().(*types.Chan)
+		if !ok || (elem != nil && !types.Identical(elem, channel.Elem())) {
+			return nil
+		}
+		elem = channel.Elem()
+	}
+	return elem
+}
+
+// checkResult reports an assertion on the result of FanIn that cannot succeed for its
+// inputs. Assertions to channels of the fan-in package's own types, such as Envelope, are
+// not checked, since configs that wrap elements return those.
+func checkResult(pass *analysis.Pass, assert *ast.TypeAssertExpr, args []ast.Expr) {
+	elem := elementType(pass, args)
+	channel, ok := pass.TypesInfo.TypeOf(assert.Type).Underlying().(*types.Chan)
+	if elem == nil || !ok || isFanType(channel.Elem(), "") {
+		return
+	}
+	expected := types.NewChan(types.RecvOnly, elem)
+	if channel.Dir() != types.RecvOnly || !types.Identical(elem, channel.Elem()) {
+		pass.Reportf(assert.Type.Pos(), "FanIn result asserted as %s, but its inputs make it %s", types.TypeString(channel, qualifier(pass)), types.TypeString(expected, qualifier(pass)))
+	}
+}
+
+// isFanType reports whether t, or what it points to, is a type declared in the fan-in
+// package with the given name, or with any name if name is empty.
+func isFanType(t types.Type, name string) bool {
+	if pointer, ok := t.(*types.Pointer); ok {
+		t = pointer.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != fanPath {
+		return false
+	}
+	return name == "" || named.Obj().Name() == name
+}
+
+// qualifier writes types relative to the package being analyzed.
+func qualifier(pass *analysis.Pass) types.Qualifier {
+	return types.RelativeTo(pass.Pkg)
+}
@@ -0,0 +1,24 @@
+// Package fan is a stand-in for the fan-in package with the declarations that fanvet looks for.
+package fan
+
+type SelectFunc func(done <-chan struct{}, in, out interface{}) bool
+
+type Config struct {
+	SelectFunc SelectFunc
+}
+
+type Source struct {
+	Channel    interface{}
+	SelectFunc SelectFunc
+}
+
+type Envelope struct {
+	Input int
+	Value interface{}
+}
+
+func (c Config) FanIn(done <-chan struct{}, channels ...interface{}) interface{} { return nil }
+
+func (c Config) FanInTo(done <-chan struct{}, out interface{}, closeOutput bool, channels ...interface{}) <-chan struct{} {
+	return nil
+}
@@ -0,0 +1,80 @@
+package misuse
+
+import (
+	fan "github.com/IBM/fast-fan-in"
+)
+
+type event struct{}
+
+func selectFuncs() {
+	_ = fan.Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan int):
+				if !more {
+					return true
+				}
+				out.(chan int64) <- int64(element) // want `SelectFunc asserts in with element type int but out with element type int64`
+			}
+			return false
+		},
+	}
+	_ = fan.Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(chan int): // want `SelectFunc asserts in as chan int, but in is always a receive-only channel`
+				if !more {
+					return true
+				}
+				out.(chan<- int) <- element // want `SelectFunc asserts out as chan<- int, but out is always a bidirectional channel`
+			}
+			return false
+		},
+	}
+	_ = fan.Config{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan int):
+				if !more {
+					return true
+				}
+				out.(chan int) <- element
+			}
+			return false
+		},
+	}
+	// sources convert between element types
+	_ = fan.Source{
+		SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			element, more := <-in.(<-chan int)
+			if more {
+				out.(chan interface{}) <- element
+			}
+			return !more
+		},
+	}
+}
+
+func channels(done <-chan struct{}, a, b chan int, c <-chan string, d chan<- int, e interface{}, all []interface{}) {
+	fan.Config{}.FanIn(done, a, b, e)
+	fan.Config{}.FanIn(done, a, c) // want `FanIn called with channels of differing element types int and string`
+	fan.Config{}.FanIn(done, a, d) // want `FanIn called with chan<- int, which does not support receive`
+	fan.Config{}.FanIn(done, a, 1) // want `FanIn called with int, which is not a channel`
+	fan.Config{}.FanIn(done, all...)
+	fan.Config{}.FanInTo(done, make(chan int), true, a, c) // want `FanInTo called with channels of differing element types int and string`
+}
+
+func results(done <-chan struct{}, a, b chan int, e interface{}, events chan event) {
+	_ = fan.Config{}.FanIn(done, a, b).(<-chan int)
+	_ = fan.Config{}.FanIn(done, e).(<-chan string)
+	_ = fan.Config{}.FanIn(done, a, b).(<-chan fan.Envelope)
+	_ = fan.Config{}.FanIn(done, a, b).(<-chan int64)      // want `FanIn result asserted as <-chan int64, but its inputs make it <-chan int`
+	_ = fan.Config{}.FanIn(done, a, b).(chan int)          // want `FanIn result asserted as chan int, but its inputs make it <-chan int`
+	_ = (fan.Config{}.FanIn(done, events)).(<-chan *event) // want `FanIn result asserted as <-chan \*event, but its inputs make it <-chan event`
+}
@@ -0,0 +1,163 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Flatten fans in channels that arrive over time. The channels argument must be a channel that
+// supports receive and whose element type is itself a channel that supports receive (such as a
+// <-chan (<-chan Msg)). Each inner channel is fanned in as soon as it is received, exactly as
+// FanIn would, and for the purposes of Envelope and Ack each one's input index is its position
+// among the inner channels received so far. The returned value is a receive-only channel of the
+// inner channels' element type, which must be type-asserted by the caller.
+//
+// The output closes when the outer channel and every inner channel have closed, or when done
+// closes. This will panic if channels is not a channel of channels that support receive, or
+// under the same conditions as FanIn for the rest of the Config.
+func (c Config) Flatten(done <-chan struct{}, channels interface{}) interface{} {
+	outer, elementType := checkFlatten("Flatten", channels)
+	if err := c.checkBatch(elementType); err != nil {
+		panic(err)
+	}
+	c.SelectFunc = c.selectFunc(elementType)
+	p := c.pipeline(done, elementType)
+	go c.flatten(done, outer, p)
+	return p.output
+}
+
+// SwitchLatest is like Flatten, but only listens to the most recently received inner channel.
+// When a new inner channel arrives, the previous one stops being read, and any elements that
+// were already received from it are sent before the first element of the new one.
+//
+// The output closes when the outer channel and the latest inner channel have closed, or when
+// done closes. It panics under the same conditions as Flatten.
+func (c Config) SwitchLatest(done <-chan struct{}, channels interface{}) interface{} {
+	outer, elementType := checkFlatten("SwitchLatest", channels)
+	if err := c.checkBatch(elementType); err != nil {
+		panic(err)
+	}
+	c.SelectFunc = c.selectFunc(elementType)
+	p := c.pipeline(done, elementType)
+	go c.switchLatest(done, outer, p)
+	return p.output
+}
+
+// checkFlatten makes sure that channels is a channel of channels that both support receive,
+// and returns it along with the inner channels' element type.
+func checkFlatten(operation string, channels interface{}) (reflect.Value, reflect.Type) {
+	t := reflect.TypeOf(channels)
+	if t == nil || t.Kind() != reflect.Chan {
+		panic(fmt.Errorf("%s() requires a channel, got %v", operation, t))
+	}
+	if t.ChanDir() != reflect.BothDir && t.ChanDir() != reflect.RecvDir {
+		panic(fmt.Errorf("%s() requires a channel that supports receive, has dir %v", operation, t.ChanDir()))
+	}
+	inner := t.Elem()
+	if inner.Kind() != reflect.Chan {
+		panic(fmt.Errorf("%s() requires a channel of channels, has element type %v", operation, inner))
+	}
+	if inner.ChanDir() != reflect.BothDir && inner.ChanDir() != reflect.RecvDir {
+		panic(fmt.Errorf("%s() requires inner channels that support receive, have dir %v", operation, inner.ChanDir()))
+	}
+	return reflect.ValueOf(channels), inner.Elem()
+}
+
+// flatten starts a worker for each channel received on outer. It closes the pipeline's sink
+// once outer and all of the workers are finished, or done closes.
+func (c Config) flatten(done <-chan struct{}, outer reflect.Value, p pipeline) {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		p.close()
+	}()
+	const (
+		DoneChanClosed = 0
+		OuterChanRead  = 1
+	)
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		OuterChanRead:  {Dir: reflect.SelectRecv, Chan: outer},
+	}
+	for input := 0; ; input++ {
+		caseChosen, inner, more := reflect.Select(selectConfig)
+		if caseChosen == DoneChanClosed || !more {
+			return
+		}
+		wg.Add(1)
+		p.start(done, input, worker{channel: inner.Interface(), loopBody: c.SelectFunc}, wg.Done)
+	}
+}
+
+// switchLatest runs a worker for the latest channel received on outer, stopping the previous
+// one first. It closes the pipeline's sink once outer and the latest worker are finished, or
+// done closes.
+func (c Config) switchLatest(done <-chan struct{}, outer reflect.Value, p pipeline) {
+	var (
+		// cancel stops the latest worker, and finished closes once it has stopped
+		cancel   chan struct{}
+		finished chan struct{}
+	)
+	stop := func() {
+		if cancel != nil {
+			close(cancel)
+			cancel = nil
+		}
+		if finished != nil {
+			<-finished
+		}
+	}
+	defer func() {
+		stop()
+		p.close()
+	}()
+	const (
+		DoneChanClosed = 0
+		OuterChanRead  = 1
+		WorkerFinished = 2
+	)
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		OuterChanRead:  {Dir: reflect.SelectRecv, Chan: outer},
+		WorkerFinished: {Dir: reflect.SelectRecv},
+	}
+	for input := 0; ; input++ {
+		caseChosen, inner, more := reflect.Select(selectConfig)
+		switch {
+		case caseChosen == DoneChanClosed || caseChosen == WorkerFinished:
+			return
+		case !more:
+			// the outer channel closed, so wait for the latest worker
+			selectConfig[OuterChanRead].Chan = reflect.Value{}
+			if finished == nil {
+				return
+			}
+			selectConfig[WorkerFinished].Chan = reflect.ValueOf(finished)
+			continue
+		}
+		stop()
+		cancel, finished = make(chan struct{}), make(chan struct{})
+		// the worker stops when it is superseded or when the whole fan-in is done
+		workerDone := make(chan struct{})
+		go func(cancel <-chan struct{}) {
+			defer close(workerDone)
+			select {
+			case <-done:
+			case <-cancel:
+			}
+		}(cancel)
+		p.start(workerDone, input, worker{channel: inner.Interface(), loopBody: c.SelectFunc}, closer(finished))
+	}
+}
+
+// closer returns a function that closes ch.
+func closer(ch chan struct{}) func() {
+	return func() { close(ch) }
+}
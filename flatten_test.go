@@ -0,0 +1,118 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestFlatten(t *testing.T) {
+	for name, config := range map[string]fan.Config{"Reflective": {}, "Ints": fan.Ints()} {
+		t.Run(name, func(t *testing.T) {
+			done := make(chan struct{})
+			defer close(done)
+			connections := make(chan (<-chan int))
+			output := config.Flatten(done, (<-chan (<-chan int))(connections)).(<-chan int)
+			results := make(chan []int)
+			go func() {
+				var received []int
+				for elem := range output {
+					received = append(received, elem)
+				}
+				results <- received
+			}()
+
+			first, second := make(chan int), make(chan int)
+			connections <- first
+			first <- 1
+			connections <- second
+			second <- 2
+			first <- 3
+			close(first)
+			close(connections)
+			// the output stays open while an inner channel is open
+			second <- 4
+			close(second)
+
+			received := <-results
+			sort.Ints(received)
+			expectInts(t, received, []int{1, 2, 3, 4})
+		})
+	}
+}
+
+func TestFlattenDone(t *testing.T) {
+	done := make(chan struct{})
+	connections := make(chan chan int)
+	output := fan.Ints().Flatten(done, connections).(<-chan int)
+	connections <- make(chan int)
+	close(done)
+	select {
+	case _, more := <-output:
+		if more {
+			t.Fatalf("expected the output to close")
+		}
+	case <-time.NewTicker(time.Millisecond * 10).C:
+		t.Fatalf("output did not close after done")
+	}
+}
+
+func TestSwitchLatest(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	connections := make(chan chan int)
+	output := fan.Ints().SwitchLatest(done, connections).(<-chan int)
+
+	first, second := make(chan int), make(chan int)
+	connections <- first
+	first <- 1
+	if elem := <-output; elem != 1 {
+		t.Fatalf("expected 1, got %d", elem)
+	}
+	connections <- second
+	second <- 2
+	if elem := <-output; elem != 2 {
+		t.Fatalf("expected 2, got %d", elem)
+	}
+	// the first channel is no longer read
+	select {
+	case first <- 3:
+		t.Fatalf("superseded channel is still being read")
+	case <-time.NewTicker(time.Millisecond * 5).C:
+	}
+	close(connections)
+	second <- 4
+	if elem := <-output; elem != 4 {
+		t.Fatalf("expected 4, got %d", elem)
+	}
+	close(second)
+	if _, more := <-output; more {
+		t.Fatalf("expected the output to close")
+	}
+}
+
+func TestFlattenPanics(t *testing.T) {
+	for name, channels := range map[string]interface{}{
+		"NotChannel":      1,
+		"NotNested":       make(chan int),
+		"SendOnlyOuter":   make(chan<- chan int),
+		"SendOnlyInner":   make(chan chan<- int),
+		"NilInterfaceArg": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic")
+				}
+			}()
+			fan.Config{}.Flatten(nil, channels)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FanInTo is like FanIn, but sends on out, a channel supplied by the caller, instead of
+// creating one. Because out already has its element type, no type assertion is needed, it may
+// have any buffer size, and it may be shared by several fan-ins feeding one consumer. Its
+// element type must be that of the channels, or *Delivery or Envelope if Ack or Envelope is
+// configured.
+//
+// If closeOutput is true, out is closed when the fan-in finishes, exactly as FanIn's output
+// would be. Otherwise it is left open, and the caller can close it once the returned channel
+// has closed for every fan-in sharing it. The returned channel closes when the fan-in has
+// stopped sending, after out has been closed if closeOutput is true.
+//
+// When out is bidirectional and no stages (such as a queue) are configured, the workers send
+// on out directly. Otherwise elements pass through an extra goroutine on the way to out.
+//
+// This will panic under the same conditions as FanIn, or if out is not a channel that supports
+// send with the expected element type.
+func (c Config) FanInTo(done <-chan struct{}, out interface{}, closeOutput bool, channels ...interface{}) <-chan struct{} {
+	elementType := checkChannels("FanInTo", channels)
+	if err := c.checkBatch(elementType); err != nil {
+		panic(err)
+	}
+	c.SelectFunc = c.selectFunc(elementType)
+	outputType, tag := c.outputType(elementType)
+	t := reflect.TypeOf(out)
+	if t == nil || t.Kind() != reflect.Chan {
+		panic(fmt.Errorf("FanInTo() requires an output channel, got %v", t))
+	}
+	if t.ChanDir() != reflect.BothDir && t.ChanDir() != reflect.SendDir {
+		panic(fmt.Errorf("FanInTo() requires an output channel that supports send, has dir %v", t.ChanDir()))
+	}
+	if t.Elem() != outputType {
+		panic(fmt.Errorf("FanInTo() output has element type %v, expected %v", t.Elem(), outputType))
+	}
+	output := reflect.ValueOf(out)
+	finished := make(chan struct{})
+	stop := func() {
+		if closeOutput {
+			output.Close()
+		}
+		close(finished)
+	}
+	if !c.staged() && tag == nil && t.ChanDir() == reflect.BothDir {
+		p := pipeline{elementType: elementType, sink: output, recover: c.Recover, stopper: c.stopper(), watch: c.watchdog(done), pool: c.Pool}
+		c.run(done, p, c.workers(channels), func() {
+			p.watch.stop()
+			stop()
+		})
+		return finished
+	}
+	p := c.pipeline(done, elementType)
+	c.run(done, p, c.workers(channels), p.close)
+	go forward(done, reflect.ValueOf(p.output), output, stop)
+	return finished
+}
+
+// forward sends every element received on in to out, calling finished when in closes or done
+// closes.
+func forward(done <-chan struct{}, in, out reflect.Value, finished func()) {
+	defer finished()
+	const (
+		DoneChanClosed = 0
+		OutputChanSent = 1
+	)
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		OutputChanSent: {Dir: reflect.SelectSend, Chan: out},
+	}
+	for {
+		elem, more := in.Recv()
+		if !more {
+			return
+		}
+		selectConfig[OutputChanSent].Send = elem
+		if caseChosen, _, _ := reflect.Select(selectConfig); caseChosen == DoneChanClosed {
+			go drain(in)
+			return
+		}
+	}
+}
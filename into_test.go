@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"sort"
+	"testing"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+// sendAll sends the elements on a new channel, which it closes afterwards.
+func sendAll(elems ...int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for _, elem := range elems {
+			out <- elem
+		}
+	}()
+	return out
+}
+
+func TestFanInToShared(t *testing.T) {
+	for name, config := range map[string]fan.Config{
+		"Reflective": {},
+		"Ints":       fan.Ints(),
+		"Queued":     {SelectFunc: fan.Ints().SelectFunc, QueueSize: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			done := make(chan struct{})
+			defer close(done)
+			out := make(chan int, 10)
+			first := config.FanInTo(done, out, false, sendAll(1, 2), sendAll(3))
+			second := config.FanInTo(done, out, false, sendAll(4, 5))
+			<-first
+			<-second
+			close(out)
+			var received []int
+			for elem := range out {
+				received = append(received, elem)
+			}
+			sort.Ints(received)
+			expectInts(t, received, []int{1, 2, 3, 4, 5})
+		})
+	}
+}
+
+func TestFanInToClose(t *testing.T) {
+	for name, out := range map[string]chan int{"Unbuffered": make(chan int), "Buffered": make(chan int, 1)} {
+		t.Run(name, func(t *testing.T) {
+			done := make(chan struct{})
+			defer close(done)
+			// the output is send-only, so the elements are forwarded to it
+			finished := fan.Config{}.FanInTo(done, (chan<- int)(out), true, sendAll(1, 2, 3))
+			var received []int
+			for elem := range out {
+				received = append(received, elem)
+			}
+			expectInts(t, received, []int{1, 2, 3})
+			<-finished
+		})
+	}
+}
+
+func TestFanInToPanics(t *testing.T) {
+	for name, out := range map[string]interface{}{
+		"NotChannel":   1,
+		"ReceiveOnly":  make(<-chan int),
+		"WrongElement": make(chan string),
+		"Nil":          nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic")
+				}
+			}()
+			fan.Config{}.FanInTo(nil, out, true, make(chan int))
+		})
+	}
+}
@@ -0,0 +1,115 @@
+//go:build go1.23
+// +build go1.23
+
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+)
+
+// FanInSeq merges the sequences into a single sequence, consuming each of them in its own
+// goroutine and fanning their elements in with c exactly as FanIn would. Nothing runs until the
+// result is iterated, and every iteration starts the sources again. The elements of each source
+// arrive in order, but there is no ordering between sources. If c has no SelectFunc, one
+// specialized to T is used instead of reflection.
+//
+// When the consumer stops early (for example with break), the iteration ends at once and each
+// source is stopped the next time it yields. This will panic if no sequences are provided or if
+// c sets Ack or Envelope, since those change the element type.
+func FanInSeq[T any](c Config, seqs ...iter.Seq[T]) iter.Seq[T] {
+	if len(seqs) == 0 {
+		panic(fmt.Errorf("FanInSeq() called with no sequences provided"))
+	}
+	if c.Ack != nil || c.Envelope != nil {
+		panic(fmt.Errorf("FanInSeq() cannot use a Config that sets Ack or Envelope"))
+	}
+	if c.SelectFunc == nil {
+		c.SelectFunc = selectFunc[T]
+	}
+	return func(yield func(T) bool) {
+		done := make(chan struct{})
+		channels := make([]interface{}, len(seqs))
+		for i, seq := range seqs {
+			channels[i] = produce(done, seq)
+		}
+		output := c.FanIn(done, channels...).(<-chan T)
+		defer stop(done, output)
+		for elem := range output {
+			if !yield(elem) {
+				return
+			}
+		}
+	}
+}
+
+// seqResult is an element or error produced by an iter.Seq2 source.
+type seqResult[T any] struct {
+	value T
+	err   error
+}
+
+// FanInSeq2 is like FanInSeq for sources that can fail. The merged sequence ends after yielding
+// the first error produced by any source, stopping the others as if the consumer had broken out
+// of the loop. A source that yields an error is not resumed. Since the sources are fanned in
+// as pairs of element and error, c's SelectFunc is replaced with one for those pairs.
+func FanInSeq2[T any](c Config, seqs ...iter.Seq2[T, error]) iter.Seq2[T, error] {
+	if len(seqs) == 0 {
+		panic(fmt.Errorf("FanInSeq2() called with no sequences provided"))
+	}
+	if c.Ack != nil || c.Envelope != nil {
+		panic(fmt.Errorf("FanInSeq2() cannot use a Config that sets Ack or Envelope"))
+	}
+	c.SelectFunc = selectFunc[seqResult[T]]
+	return func(yield func(T, error) bool) {
+		done := make(chan struct{})
+		channels := make([]interface{}, len(seqs))
+		for i, seq := range seqs {
+			channels[i] = produce(done, func(yield func(seqResult[T]) bool) {
+				for value, err := range seq {
+					if !yield(seqResult[T]{value: value, err: err}) || err != nil {
+						return
+					}
+				}
+			})
+		}
+		output := c.FanIn(done, channels...).(<-chan seqResult[T])
+		defer stop(done, output)
+		for result := range output {
+			if !yield(result.value, result.err) || result.err != nil {
+				return
+			}
+		}
+	}
+}
+
+// produce starts a goroutine that sends the elements of seq on the returned channel, which it
+// closes when seq ends or done closes.
+func produce[T any](done <-chan struct{}, seq iter.Seq[T]) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for elem := range seq {
+			select {
+			case <-done:
+				return
+			case out <- elem:
+			}
+		}
+	}()
+	return out
+}
+
+// stop ends an iteration by closing done, and drains output so that no worker is left blocked
+// sending on it.
+func stop[T any](done chan struct{}, output <-chan T) {
+	close(done)
+	go drain(reflect.ValueOf(output))
+}
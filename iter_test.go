@@ -0,0 +1,111 @@
+//go:build go1.23
+// +build go1.23
+
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestFanInSeq(t *testing.T) {
+	for name, config := range map[string]fan.Config{"Reflective": {}, "Ints": fan.Ints()} {
+		t.Run(name, func(t *testing.T) {
+			merged := fan.FanInSeq(config, slices.Values([]int{1, 2, 3}), slices.Values([]int{4, 5}))
+			// iterate twice, since each iteration starts the sources again
+			for i := 0; i < 2; i++ {
+				received := slices.Collect(merged)
+				sort.Ints(received)
+				if !slices.Equal(received, []int{1, 2, 3, 4, 5}) {
+					t.Fatalf("expected 1 through 5, got %v", received)
+				}
+			}
+		})
+	}
+}
+
+// counter yields increasing integers forever, and closes stopped once it is stopped.
+func counter(stopped chan<- struct{}) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		defer close(stopped)
+		for i := 0; yield(i); i++ {
+		}
+	}
+}
+
+func expectStopped(t *testing.T, stopped <-chan struct{}) {
+	select {
+	case <-stopped:
+	case <-time.NewTicker(time.Millisecond * 10).C:
+		t.Fatalf("source was not stopped")
+	}
+}
+
+func TestFanInSeqBreak(t *testing.T) {
+	a, b := make(chan struct{}), make(chan struct{})
+	received := 0
+	for range fan.FanInSeq(fan.Config{}, counter(a), counter(b)) {
+		if received++; received == 10 {
+			break
+		}
+	}
+	expectStopped(t, a)
+	expectStopped(t, b)
+}
+
+func TestFanInSeq2(t *testing.T) {
+	failure := errors.New("failure")
+	failing := func(yield func(int, error) bool) {
+		if yield(1, nil) {
+			yield(0, failure)
+		}
+	}
+	stopped := make(chan struct{})
+	endless := func(yield func(int, error) bool) {
+		for elem := range counter(stopped) {
+			if !yield(elem, nil) {
+				return
+			}
+		}
+	}
+	// the merged sequence ends by itself after the error
+	var err error
+	for _, e := range fan.FanInSeq2(fan.Config{}, failing, endless) {
+		if e != nil {
+			err = e
+		}
+	}
+	if err != failure {
+		t.Fatalf("expected the source's error, got %v", err)
+	}
+	expectStopped(t, stopped)
+
+	succeeding := func(yield func(int, error) bool) {
+		for elem := range slices.Values([]int{1, 2, 3}) {
+			if !yield(elem, nil) {
+				return
+			}
+		}
+	}
+	sum := 0
+	for elem, err := range fan.FanInSeq2(fan.Ints(), succeeding, succeeding) {
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		sum += elem
+	}
+	if sum != 12 {
+		t.Fatalf("expected the elements to sum to 12, got %d", sum)
+	}
+}
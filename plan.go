@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Plan is a fan-in prepared ahead of time for a fixed element type and number of inputs. The
+// checks and reflective lookups that FanIn makes on every call are made once, when the plan is
+// made, so that each fan-in with the plan costs little more than creating its output channel
+// and starting its workers. If the workers grow deep stacks, setting the config's Pool makes
+// starting them cheaper too. Plans suit code that starts many short-lived fan-ins, such as one
+// per request.
+//
+// A Plan is safe for concurrent use.
+type Plan struct {
+	config      Config
+	elementType reflect.Type
+	inputs      int
+	// recvInputType is the type that the workers receive their inputs as
+	recvInputType reflect.Type
+	// direct is set if the workers send straight to the output, which has types outputType
+	// and recvOutputType. Otherwise the plan builds a pipeline for each fan-in.
+	direct                     bool
+	outputType, recvOutputType reflect.Type
+}
+
+// Plan prepares fan-ins of inputs channels with the same element type as sampleChan (which can
+// be any channel of that type, and is only used for its type).
+//
+// This will panic if sampleChan is not a channel, if inputs is not positive, if the
+// SelectFunc does not work with the element type (see Validate), or if the config combines
+// options that cannot be combined.
+func (c Config) Plan(sampleChan interface{}, inputs int) *Plan {
+	t := reflect.TypeOf(sampleChan)
+	if t == nil || t.Kind() != reflect.Chan {
+		panic(fmt.Errorf("Plan() requires a channel, got %v", t))
+	}
+	if inputs < 1 {
+		panic(fmt.Errorf("Plan() requires at least one input, got %d", inputs))
+	}
+	elementType := t.Elem()
+	if err := c.Validate(elementType); err != nil {
+		panic(err)
+	}
+	c.SelectFunc = c.selectFunc(elementType)
+	outputType, tag := c.outputType(elementType)
+	return &Plan{
+		config:         c,
+		elementType:    elementType,
+		inputs:         inputs,
+		recvInputType:  reflect.ChanOf(reflect.RecvDir, elementType),
+		direct:         !c.staged() && tag == nil && c.Watchdog == nil && c.batch == nil,
+		outputType:     reflect.ChanOf(reflect.BothDir, outputType),
+		recvOutputType: reflect.ChanOf(reflect.RecvDir, outputType),
+	}
+}
+
+// FanIn fans in the channels exactly as the plan's config would, and returns the same kind of
+// receive-only channel, which must be type-asserted by the caller.
+//
+// This will panic if the number of channels differs from the plan's, or if any of them is not
+// a channel of the plan's element type that supports receive. As with FanIn, the channels may
+// have named types.
+func (p *Plan) FanIn(done <-chan struct{}, channels ...interface{}) interface{} {
+	if len(channels) != p.inputs {
+		panic(fmt.Errorf("Plan.FanIn() called with %d channels, but the plan is for %d", len(channels), p.inputs))
+	}
+	workers := make([]worker, len(channels))
+	for i, channel := range channels {
+		t := reflect.TypeOf(channel)
+		if t == nil || t.Kind() != reflect.Chan || t.Elem() != p.elementType || t.ChanDir() == reflect.SendDir {
+			panic(fmt.Errorf("channels[%d] has type %v, but the plan is for %v", i, t, p.recvInputType))
+		}
+		workers[i] = worker{channel: channel, loopBody: p.config.SelectFunc, inputType: p.recvInputType}
+	}
+	if !p.direct {
+		return p.config.fanIn(done, p.elementType, workers)
+	}
+	output := reflect.MakeChan(p.outputType, 0)
+	pipeline := pipeline{
+		elementType: p.elementType,
+		sink:        output,
+		output:      output.Convert(p.recvOutputType).Interface(),
+		recover:     p.config.Recover,
+		stopper:     p.config.stopper(),
+		pool:        p.config.Pool,
+	}
+	pipeline.run(done, workers, pipeline.close)
+	return pipeline.output
+}
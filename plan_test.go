@@ -0,0 +1,92 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan_test
+
+import (
+	"sort"
+	"testing"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestPlan(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	for name, config := range map[string]fan.Config{
+		"specialized": fan.Ints(),
+		"registered":  {},
+		"recovered":   {Recover: &fan.RecoverConfig{}},
+		"queued":      {QueueSize: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			plan := config.Plan(make(chan int), 2)
+			// a plan can be used any number of times
+			for i := 0; i < 3; i++ {
+				bidirectional := make(chan int, 1)
+				bidirectional <- i
+				close(bidirectional)
+				received := receiveAll(t, plan.FanIn(done, bidirectional, sendAll(10+i)).(<-chan int))
+				sort.Ints(received)
+				expectInts(t, []int{i, 10 + i}, received)
+			}
+		})
+	}
+}
+
+func TestPlanDone(t *testing.T) {
+	done := make(chan struct{})
+	plan := fan.Ints().Plan(make(chan int), 1)
+	out := plan.FanIn(done, make(chan int)).(<-chan int)
+	close(done)
+	expectInts(t, nil, receiveAll(t, out))
+}
+
+func TestPlanInvalid(t *testing.T) {
+	expectPanic := func(t *testing.T, f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected a panic")
+			}
+		}()
+		f()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	t.Run("not a channel", func(t *testing.T) {
+		expectPanic(t, func() { fan.Ints().Plan(1, 1) })
+	})
+	t.Run("no inputs", func(t *testing.T) {
+		expectPanic(t, func() { fan.Ints().Plan(make(chan int), 0) })
+	})
+	t.Run("wrong SelectFunc", func(t *testing.T) {
+		expectPanic(t, func() { fan.Strings().Plan(make(chan int), 1) })
+	})
+	plan := fan.Ints().Plan(make(chan int), 2)
+	t.Run("wrong count", func(t *testing.T) {
+		expectPanic(t, func() { plan.FanIn(done, make(chan int)) })
+	})
+	t.Run("wrong type", func(t *testing.T) {
+		expectPanic(t, func() { plan.FanIn(done, make(chan int), make(chan string)) })
+	})
+	t.Run("send-only", func(t *testing.T) {
+		expectPanic(t, func() { plan.FanIn(done, make(chan int), make(chan<- int)) })
+	})
+}
+
+// intChan is a named channel type, which FanIn and Plan.FanIn both accept.
+type intChan chan int
+
+func TestPlanNamedChannels(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	named := make(intChan, 1)
+	named <- 1
+	close(named)
+	received := receiveAll(t, fan.Ints().Plan(make(chan int), 2).FanIn(done, named, sendAll(2)).(<-chan int))
+	sort.Ints(received)
+	expectInts(t, []int{1, 2}, received)
+}
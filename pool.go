@@ -0,0 +1,88 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool keeps the goroutines of finished fan-in workers so that later fan-ins can reuse them,
+// which saves starting a goroutine (and growing its stack) for every worker of every fan-in.
+// Handing a worker to an idle goroutine has a cost of its own, a little more than starting a
+// small goroutine, so a pool only helps when workers grow their stacks, such as with SelectFuncs
+// that make deep calls (see BenchmarkDeepWorkers). With small workers it is slower (see
+// BenchmarkShortLived), so measure before adopting one. A Pool may be shared by any number of
+// Configs and Plans, and is safe for concurrent use.
+//
+// A worker occupies its goroutine until its input closes or its fan-in's done channel closes,
+// so the pool never makes a worker wait for a goroutine: when none is idle, a new one is
+// started.
+type Pool struct {
+	// idle is the number of goroutines waiting for work
+	idle   int32
+	size   int32
+	tasks  chan func()
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewPool returns a pool that keeps up to size idle goroutines. This will panic if size is not
+// positive.
+func NewPool(size int) *Pool {
+	if size <= 0 {
+		panic(fmt.Errorf("NewPool() requires a positive size, got %d", size))
+	}
+	return &Pool{
+		size:   int32(size),
+		tasks:  make(chan func()),
+		closed: make(chan struct{}),
+	}
+}
+
+// Close stops the pool's idle goroutines. Workers that are running are not affected, but their
+// goroutines exit once they finish. Fan-ins that use the pool after it has closed start a new
+// goroutine for every worker, as if they had no pool.
+func (p *Pool) Close() {
+	p.once.Do(func() { close(p.closed) })
+}
+
+// run calls task on an idle goroutine if there is one, or on a new goroutine. It is safe to call
+// on a nil Pool, which always starts a new goroutine.
+func (p *Pool) run(task func()) {
+	if p == nil {
+		go task()
+		return
+	}
+	select {
+	case p.tasks <- task:
+	default:
+		go p.work(task)
+	}
+}
+
+// work calls task, and then waits to be handed more tasks unless the pool already has enough
+// idle goroutines or has closed.
+func (p *Pool) work(task func()) {
+	for {
+		task()
+		// don't keep the finished fan-in's channels alive while waiting
+		task = nil
+		if atomic.AddInt32(&p.idle, 1) > p.size {
+			atomic.AddInt32(&p.idle, -1)
+			return
+		}
+		select {
+		case task = <-p.tasks:
+			atomic.AddInt32(&p.idle, -1)
+		case <-p.closed:
+			atomic.AddInt32(&p.idle, -1)
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan_test
+
+import (
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+// waitForGoroutines waits for the number of goroutines to be at most n.
+func waitForGoroutines(t *testing.T, n int) {
+	for start := time.Now(); runtime.NumGoroutine() > n; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("expected at most %d goroutines, have %d", n, runtime.NumGoroutine())
+		}
+	}
+}
+
+func TestPoolReusesGoroutines(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	const size = 4
+	before := runtime.NumGoroutine()
+	pool := fan.NewPool(size)
+	config := fan.Ints()
+	config.Pool = pool
+	for i := 0; i < 50; i++ {
+		received := receiveAll(t, config.FanIn(done, sendAll(i), sendAll(i+1), sendAll(i+2)).(<-chan int))
+		sort.Ints(received)
+		expectInts(t, []int{i, i + 1, i + 2}, received)
+	}
+	// only the idle goroutines remain
+	waitForGoroutines(t, before+size)
+
+	pool.Close()
+	waitForGoroutines(t, before)
+	// a closed pool still runs workers
+	expectInts(t, []int{1}, receiveAll(t, config.FanIn(done, sendAll(1)).(<-chan int)))
+}
+
+func TestNewPoolInvalidSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewPool(0) to panic")
+		}
+	}()
+	fan.NewPool(0)
+}
@@ -0,0 +1,244 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy determines what a fan-in does with an element that arrives while its
+// output queue is full.
+type OverflowPolicy int
+
+const (
+	// Block stops receiving from the inputs until the consumer makes room in the queue.
+	// This is the default.
+	Block OverflowPolicy = iota
+	// DropNewest discards the element that just arrived.
+	DropNewest
+	// DropOldest discards the element at the front of the queue to make room for the one
+	// that just arrived.
+	DropOldest
+	// Shed behaves like Block until the queue has been at or above the configured high-water
+	// mark for the configured duration, then discards incoming elements until the queue falls
+	// back below the high-water mark.
+	Shed
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "Block"
+	case DropNewest:
+		return "DropNewest"
+	case DropOldest:
+		return "DropOldest"
+	case Shed:
+		return "Shed"
+	}
+	return "OverflowPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// Stats collects counters describing a fan-in operation. Its methods are safe to call
+// while the fan-in is running. A single Stats may be shared by several fan-ins, in which
+// case it reports their totals.
+type Stats struct {
+	// the counters must be first in the struct to guarantee 64-bit alignment for atomic
+	// operations on 32-bit platforms
+	dropped, missing, duplicates uint64
+}
+
+// Dropped returns the number of elements that were discarded by an overflow policy.
+func (s *Stats) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Missing returns the number of upstream sequence numbers that were skipped, as detected
+// by EnvelopeConfig.SequenceID.
+func (s *Stats) Missing() uint64 {
+	return atomic.LoadUint64(&s.missing)
+}
+
+// Duplicates returns the number of elements whose upstream sequence number was repeated
+// or out of order, as detected by EnvelopeConfig.SequenceID.
+func (s *Stats) Duplicates() uint64 {
+	return atomic.LoadUint64(&s.duplicates)
+}
+
+func (s *Stats) addDropped(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.dropped, n)
+	}
+}
+
+func (s *Stats) addMissing(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.missing, n)
+	}
+}
+
+func (s *Stats) addDuplicates(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.duplicates, n)
+	}
+}
+
+// ring is a fixed-capacity FIFO of elements.
+type ring struct {
+	elems      []reflect.Value
+	head, size int
+}
+
+func newRing(capacity int) *ring {
+	return &ring{elems: make([]reflect.Value, capacity)}
+}
+
+func (r *ring) len() int   { return r.size }
+func (r *ring) full() bool { return r.size == len(r.elems) }
+
+func (r *ring) push(v reflect.Value) {
+	r.elems[(r.head+r.size)%len(r.elems)] = v
+	r.size++
+}
+
+func (r *ring) peek() reflect.Value {
+	return r.elems[r.head]
+}
+
+func (r *ring) pop() reflect.Value {
+	v := r.elems[r.head]
+	r.elems[r.head] = reflect.Value{}
+	r.head = (r.head + 1) % len(r.elems)
+	r.size--
+	return v
+}
+
+// queue moves elements from in to out, holding up to c.QueueSize of them while the consumer
+// of out is not ready and applying c.Overflow when that limit is reached. If disk is not nil,
+// elements beyond that limit are written to it instead. It closes out when done closes or
+// when in closes and every queued element has been delivered.
+func (c Config) queue(done <-chan struct{}, in, out reflect.Value, disk *spill) {
+	defer out.Close()
+	if disk != nil {
+		defer disk.close()
+	}
+	const (
+		DoneChanClosed = 0
+		InputChanRead  = 1
+		OutputChanSent = 2
+		ShedTimerFired = 3
+	)
+	highWater := c.HighWater
+	if highWater <= 0 || highWater > c.QueueSize {
+		highWater = c.QueueSize
+	}
+	var (
+		pending   = newRing(c.QueueSize)
+		input     = in
+		aboveHigh time.Time // when the queue most recently reached the high-water mark
+		shedding  bool
+		timer     *time.Timer
+	)
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+	}
+	defer stopTimer()
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		InputChanRead:  {Dir: reflect.SelectRecv},
+		OutputChanSent: {Dir: reflect.SelectSend},
+		ShedTimerFired: {Dir: reflect.SelectRecv},
+	}
+	for {
+		// refill memory from disk in FIFO order
+		for disk != nil && disk.len() > 0 && !pending.full() {
+			elem, lost, err := disk.pop()
+			if err != nil {
+				c.Spill.report(err)
+			}
+			c.Stats.addDropped(uint64(lost))
+			if elem.IsValid() {
+				pending.push(elem)
+			}
+		}
+		// track how long the queue has been above the high-water mark for the Shed policy
+		if c.Overflow == Shed && disk == nil {
+			if pending.len() < highWater {
+				aboveHigh, shedding = time.Time{}, false
+				stopTimer()
+			} else if aboveHigh.IsZero() {
+				aboveHigh = time.Now()
+				if c.ShedAfter <= 0 {
+					shedding = true
+				} else {
+					timer = time.NewTimer(c.ShedAfter)
+				}
+			}
+		}
+		if !input.IsValid() && pending.len() == 0 {
+			return
+		}
+		// zero Values disable a select case, so only listen for input while we can accept
+		// it and only offer output while we have some
+		full := pending.full() && disk == nil
+		selectConfig[InputChanRead].Chan = input
+		if full && (c.Overflow == Block || (c.Overflow == Shed && !shedding)) {
+			selectConfig[InputChanRead].Chan = reflect.Value{}
+		}
+		selectConfig[OutputChanSent].Chan = reflect.Value{}
+		selectConfig[OutputChanSent].Send = reflect.Value{}
+		if pending.len() > 0 {
+			selectConfig[OutputChanSent].Chan = out
+			selectConfig[OutputChanSent].Send = pending.peek()
+		}
+		selectConfig[ShedTimerFired].Chan = reflect.Value{}
+		if timer != nil {
+			selectConfig[ShedTimerFired].Chan = reflect.ValueOf(timer.C)
+		}
+		switch caseChosen, elem, more := reflect.Select(selectConfig); caseChosen {
+		case DoneChanClosed:
+			if input.IsValid() {
+				go drain(input)
+			}
+			return
+		case InputChanRead:
+			if !more {
+				input = reflect.Value{}
+				continue
+			}
+			switch {
+			case disk != nil && (pending.full() || disk.len() > 0):
+				if err := disk.push(elem); err != nil {
+					c.Spill.report(err)
+					c.Stats.addDropped(1)
+				}
+			case c.Overflow == Shed && shedding:
+				c.Stats.addDropped(1)
+			case !pending.full():
+				pending.push(elem)
+			case c.Overflow == DropNewest:
+				c.Stats.addDropped(1)
+			case c.Overflow == DropOldest:
+				pending.pop()
+				pending.push(elem)
+				c.Stats.addDropped(1)
+			}
+		case OutputChanSent:
+			pending.pop()
+		case ShedTimerFired:
+			timer = nil
+			shedding = true
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+// testTimeout is how long tests wait for something that should happen promptly. It is only
+// reached if a test is about to fail.
+const testTimeout = time.Second
+
+// fillQueue sends the numbers 0-(n-1) on a fresh input channel fanned in with the given
+// config without reading the output, and returns the output channel and the input channel
+// (which it has not closed). The last element may not have reached the queue yet.
+func fillQueue(t *testing.T, config fan.Config, n int) (<-chan int, chan int) {
+	in := make(chan int)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	out := config.FanIn(done, in).(<-chan int)
+	timeout := time.After(testTimeout)
+	for i := 0; i < n; i++ {
+		select {
+		case <-timeout:
+			t.Fatalf("timed out sending element %d", i)
+		case in <- i:
+		}
+	}
+	return out, in
+}
+
+// waitForDropped waits until stats has counted n dropped elements.
+func waitForDropped(t *testing.T, stats *fan.Stats, n uint64) {
+	for start := time.Now(); stats.Dropped() < n; time.Sleep(time.Millisecond) {
+		if time.Since(start) > testTimeout {
+			t.Fatalf("expected %d dropped elements, got %d", n, stats.Dropped())
+		}
+	}
+}
+
+func receiveAll(t *testing.T, out <-chan int) []int {
+	var received []int
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case <-timeout:
+			t.Fatalf("timed out")
+		case elem, more := <-out:
+			if !more {
+				return received
+			}
+			received = append(received, elem)
+		}
+	}
+}
+
+func expectInts(t *testing.T, expected, actual []int) {
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	stats := &fan.Stats{}
+	// the worker holds one more element than the queue while it waits for room
+	out, in := fillQueue(t, fan.Config{QueueSize: 3, Stats: stats}, 4)
+	select {
+	case in <- 4:
+		t.Fatalf("should have blocked when the queue was full")
+	case <-time.After(time.Millisecond * 10):
+	}
+	close(in)
+	expectInts(t, []int{0, 1, 2, 3}, receiveAll(t, out))
+	if stats.Dropped() != 0 {
+		t.Fatalf("expected no dropped elements, got %d", stats.Dropped())
+	}
+}
+
+func TestQueueDropNewest(t *testing.T) {
+	stats := &fan.Stats{}
+	config := fan.Ints()
+	config.QueueSize = 3
+	config.Overflow = fan.DropNewest
+	config.Stats = stats
+	out, in := fillQueue(t, config, 5)
+	// the consumer would make room if it started before the queue had dropped anything
+	waitForDropped(t, stats, 2)
+	close(in)
+	expectInts(t, []int{0, 1, 2}, receiveAll(t, out))
+	if stats.Dropped() != 2 {
+		t.Fatalf("expected 2 dropped elements, got %d", stats.Dropped())
+	}
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	stats := &fan.Stats{}
+	out, in := fillQueue(t, fan.Config{QueueSize: 3, Overflow: fan.DropOldest, Stats: stats}, 5)
+	waitForDropped(t, stats, 2)
+	close(in)
+	expectInts(t, []int{2, 3, 4}, receiveAll(t, out))
+	if stats.Dropped() != 2 {
+		t.Fatalf("expected 2 dropped elements, got %d", stats.Dropped())
+	}
+}
+
+func TestQueueShed(t *testing.T) {
+	stats := &fan.Stats{}
+	config := fan.Config{
+		QueueSize: 4,
+		Overflow:  fan.Shed,
+		HighWater: 2,
+		ShedAfter: time.Millisecond * 20,
+		Stats:     stats,
+	}
+	out, in := fillQueue(t, config, 4)
+	if stats.Dropped() != 0 {
+		t.Fatalf("should not shed before the high-water duration elapses, dropped %d", stats.Dropped())
+	}
+	// the queue is full, so it takes no more elements until it starts shedding
+	in <- 4
+	in <- 5
+	waitForDropped(t, stats, 2)
+	close(in)
+	expectInts(t, []int{0, 1, 2, 3}, receiveAll(t, out))
+	if stats.Dropped() != 2 {
+		t.Fatalf("expected 2 dropped elements, got %d", stats.Dropped())
+	}
+}
+
+func TestQueueDone(t *testing.T) {
+	in := make(chan int)
+	done := make(chan struct{})
+	out := fan.Config{QueueSize: 3}.FanIn(done, in).(<-chan int)
+	in <- 0
+	close(done)
+	for range out {
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// RecoverConfig configures how a fan-in recovers from panics in its workers, such as a
+// SelectFunc making the wrong type assertion.
+type RecoverConfig struct {
+	// OnPanic, if set, is called from the worker's goroutine with each recovered panic.
+	OnPanic func(*PanicError)
+
+	// StopAll, if true, stops every worker of the fan-in after any of them panics, as if the
+	// done channel had closed. Otherwise only the input whose worker panicked stops being
+	// read, and the others keep running.
+	StopAll bool
+}
+
+// PanicError describes a panic recovered from a fan-in worker.
+type PanicError struct {
+	// Input is the index of the channel (as passed to FanIn) that the worker was reading.
+	Input int
+	// Value is the value that was passed to panic.
+	Value interface{}
+	// Stack is the worker goroutine's stack trace at the time of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("fan-in worker for channels[%d] panicked: %v\n\n%s", e.Input, e.Value, e.Stack)
+}
+
+// stopper is closed when a fan-in's workers should stop because one of them panicked.
+type stopper struct {
+	once    sync.Once
+	stopped chan struct{}
+}
+
+func (s *stopper) stop() {
+	s.once.Do(func() { close(s.stopped) })
+}
+
+// handle must be deferred by a worker. It recovers a panic, reports it, and stops the other
+// workers if configured to.
+func (r *RecoverConfig) handle(input int, s *stopper) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	err := &PanicError{Input: input, Value: value, Stack: debug.Stack()}
+	if r.OnPanic != nil {
+		r.OnPanic(err)
+	}
+	if s != nil {
+		s.stop()
+	}
+}
+
+// guard returns a channel that closes when either done closes or the stopper stops, until
+// release is called.
+func (s *stopper) guard(done <-chan struct{}) (guarded <-chan struct{}, release func()) {
+	merged, released := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(merged)
+		select {
+		case <-done:
+		case <-s.stopped:
+		case <-released:
+		}
+	}()
+	return merged, func() { close(released) }
+}
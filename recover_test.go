@@ -0,0 +1,69 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+// unlucky is a SelectFunc for ints that panics when it receives 13.
+func unlucky(done <-chan struct{}, in, out interface{}) bool {
+	select {
+	case <-done:
+		return true
+	case element, more := <-in.(<-chan int):
+		if !more {
+			return true
+		}
+		if element == 13 {
+			var m map[int]int
+			m[element] = element
+		}
+		out.(chan int) <- element
+	}
+	return false
+}
+
+func TestRecoverContinues(t *testing.T) {
+	panics := make(chan *fan.PanicError, 1)
+	output := fan.Config{
+		SelectFunc: unlucky,
+		Recover:    &fan.RecoverConfig{OnPanic: func(err *fan.PanicError) { panics <- err }},
+	}.FanIn(nil, sendAll(1, 13, 2), sendAll(3, 4)).(<-chan int)
+
+	// the first input stops after its worker panics, but the second keeps going
+	received := map[int]bool{}
+	for elem := range output {
+		received[elem] = true
+	}
+	if !received[1] || received[2] || !received[3] || !received[4] {
+		t.Fatalf("unexpected elements %v", received)
+	}
+	err := <-panics
+	if err.Input != 0 || !strings.Contains(err.Error(), "nil map") || len(err.Stack) == 0 {
+		t.Fatalf("unexpected panic error %v", err)
+	}
+}
+
+func TestRecoverStopAll(t *testing.T) {
+	endless := make(chan int)
+	output := fan.Config{
+		SelectFunc: unlucky,
+		Recover:    &fan.RecoverConfig{StopAll: true},
+	}.FanIn(nil, endless, sendAll(13)).(<-chan int)
+	select {
+	case _, more := <-output:
+		if more {
+			t.Fatalf("expected the output to close")
+		}
+	case <-time.NewTicker(time.Millisecond * 10).C:
+		t.Fatalf("output did not close after a panic")
+	}
+}
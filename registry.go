@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// registry maps element types to SelectFuncs specialized to them. It is used whenever a
+// Config has no SelectFunc of its own.
+var registry = struct {
+	sync.RWMutex
+	funcs map[reflect.Type]SelectFunc
+}{funcs: make(map[reflect.Type]SelectFunc)}
+
+func init() {
+	for _, sample := range []struct {
+		channel interface{}
+		config  Config
+	}{
+		{make(chan interface{}), Interfaces()},
+		{make(chan string), Strings()},
+		{make(chan []byte), ByteSlices()},
+		{make(chan uintptr), Uintptrs()},
+		{make(chan bool), Bools()},
+		{make(chan byte), Bytes()},
+		{make(chan rune), Runes()},
+		{make(chan complex64), Complex64s()},
+		{make(chan complex128), Complex128s()},
+		{make(chan float32), Float32s()},
+		{make(chan float64), Float64s()},
+		{make(chan int), Ints()},
+		{make(chan uint), Uints()},
+		{make(chan int8), Int8s()},
+		{make(chan uint8), Uint8s()},
+		{make(chan int16), Int16s()},
+		{make(chan uint16), Uint16s()},
+		{make(chan int32), Int32s()},
+		{make(chan uint32), Uint32s()},
+		{make(chan int64), Int64s()},
+		{make(chan uint64), Uint64s()},
+		{make(chan error), Errors()},
+		{make(chan struct{}), EmptyStructs()},
+		{make(chan time.Time), Times()},
+		{make(chan time.Duration), Durations()},
+		{make(chan []string), StringSlices()},
+		{make(chan map[string]interface{}), StringInterfaceMaps()},
+	} {
+		registry.funcs[reflect.TypeOf(sample.channel).Elem()] = sample.config.SelectFunc
+	}
+}
+
+// Register makes f the SelectFunc used for channels with the same element type as sampleChan
+// (which can be any channel of that type, and is only used for its type) whenever a Config
+// does not provide its own SelectFunc. Each of the built-in Configs, such as Ints(), is
+// registered already. Registering another SelectFunc for a type replaces the previous one.
+// Register is safe to call concurrently with FanIn, but is usually called from an init
+// function.
+//
+// This will panic if sampleChan is not a channel, if f is nil, or if f does not work with
+// sampleChan's element type (see Config.Validate).
+func Register(sampleChan interface{}, f SelectFunc) {
+	t := reflect.TypeOf(sampleChan)
+	if t == nil || t.Kind() != reflect.Chan {
+		panic(fmt.Errorf("Register() requires a channel, got %v", t))
+	}
+	if f == nil {
+		panic(fmt.Errorf("Register() called with a nil SelectFunc for element type %v", t.Elem()))
+	}
+	if err := validateSelectFunc(f, t.Elem()); err != nil {
+		panic(err)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	registry.funcs[t.Elem()] = f
+}
+
+// selectFunc returns the SelectFunc to use for channels of elementType: the config's own, or
+// else the registered one, or else nil.
+func (c Config) selectFunc(elementType reflect.Type) SelectFunc {
+	if c.SelectFunc != nil {
+		return c.SelectFunc
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.funcs[elementType]
+}
@@ -0,0 +1,63 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+type registered struct{ id int }
+
+func TestRegister(t *testing.T) {
+	var calls int64
+	fan.Register(make(chan registered), func(done <-chan struct{}, in, out interface{}) bool {
+		atomic.AddInt64(&calls, 1)
+		select {
+		case <-done:
+			return true
+		case element, more := <-in.(<-chan registered):
+			if !more {
+				return true
+			}
+			out.(chan registered) <- element
+		}
+		return false
+	})
+	input := make(chan registered, 2)
+	input <- registered{1}
+	input <- registered{2}
+	close(input)
+	var received []registered
+	for elem := range (fan.Config{}).FanIn(nil, input).(<-chan registered) {
+		received = append(received, elem)
+	}
+	if len(received) != 2 || received[0].id != 1 || received[1].id != 2 {
+		t.Fatalf("unexpected output %v", received)
+	}
+	if atomic.LoadInt64(&calls) == 0 {
+		t.Fatalf("registered SelectFunc was not used")
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	for name, register := range map[string]func(){
+		"NotChannel": func() { fan.Register(1, fan.Ints().SelectFunc) },
+		"Nil":        func() { fan.Register(make(chan int), nil) },
+		"Mismatched": func() { fan.Register(make(chan string), fan.Ints().SelectFunc) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic")
+				}
+			}()
+			register()
+		})
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Route describes which elements a Router delivers to a route's channel, and how the route
+// queues them.
+type Route struct {
+	// Match reports whether an element belongs on this route. If it is nil, the route is a
+	// default route, which receives the elements that match no other route.
+	Match func(elem interface{}) bool
+
+	// Buffer is the number of elements that the route's queue can hold while its consumer is
+	// not ready. Every route has a queue of its own, so that a slow consumer does not hold up
+	// the other routes. If it is not positive, DefaultRouteBuffer is used.
+	Buffer int
+
+	// Overflow determines what happens to elements that arrive while the queue is full. Block,
+	// the default, is the exception to routes not holding each other up: once a route's queue
+	// is full, the whole router stalls until its consumer makes room. With DropNewest,
+	// DropOldest or Shed a slow route never stalls the others.
+	Overflow OverflowPolicy
+
+	// Stats, if set, will be updated with counters describing the route.
+	Stats *Stats
+}
+
+// DefaultRouteBuffer is the size of a route's queue when Route.Buffer is not set.
+const DefaultRouteBuffer = 64
+
+// Router delivers each element of a stream (such as the output of FanIn) to every route whose
+// predicate matches it. Routes may be added and removed while the router is running. Its methods
+// are safe for concurrent use.
+type Router struct {
+	elementType reflect.Type
+	commands    chan routerCommand
+	stopped     chan struct{}
+}
+
+type routerCommand struct {
+	name  string
+	route *Route // nil to remove the route
+	reply chan interface{}
+}
+
+// activeRoute is a route that the router is currently delivering to.
+type activeRoute struct {
+	Route
+	name   string
+	intake reflect.Value
+}
+
+// NewRouter starts routing the elements received on in, which must be a channel that supports
+// receive. The router stops, closing all of its routes' channels, when in closes or when done
+// closes. Elements that arrive while no route (including a default route) matches are dropped.
+func NewRouter(done <-chan struct{}, in interface{}) *Router {
+	t := reflect.TypeOf(in)
+	if t == nil || t.Kind() != reflect.Chan {
+		panic(fmt.Errorf("NewRouter() requires a channel, got %v", t))
+	}
+	if t.ChanDir() != reflect.BothDir && t.ChanDir() != reflect.RecvDir {
+		panic(fmt.Errorf("NewRouter() requires a channel that supports receive, has dir %v", t.ChanDir()))
+	}
+	r := &Router{
+		elementType: t.Elem(),
+		commands:    make(chan routerCommand),
+		stopped:     make(chan struct{}),
+	}
+	go r.run(done, reflect.ValueOf(in))
+	return r
+}
+
+// Add starts delivering matching elements to a new route and returns its receive-only channel,
+// which has the same element type as the router's input and must be type-asserted by the
+// caller. If a route with the same name exists, it is removed first. If the router has already
+// stopped, the returned channel is closed.
+func (r *Router) Add(name string, route Route) interface{} {
+	reply := make(chan interface{})
+	select {
+	case r.commands <- routerCommand{name: name, route: &route, reply: reply}:
+		return <-reply
+	case <-r.stopped:
+		closed := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, r.elementType), 0)
+		closed.Close()
+		return closed.Convert(reflect.ChanOf(reflect.RecvDir, r.elementType)).Interface()
+	}
+}
+
+// Remove stops delivering to the named route. Elements already buffered for the route are
+// still delivered, then its channel closes. It reports whether the route existed.
+func (r *Router) Remove(name string) bool {
+	reply := make(chan interface{})
+	select {
+	case r.commands <- routerCommand{name: name, reply: reply}:
+		return (<-reply).(bool)
+	case <-r.stopped:
+		return false
+	}
+}
+
+// open creates the channels for a route and starts its queue.
+func (r *Router) open(done <-chan struct{}, name string, route Route) (*activeRoute, interface{}) {
+	if route.Buffer <= 0 {
+		route.Buffer = DefaultRouteBuffer
+	}
+	chanType := reflect.ChanOf(reflect.BothDir, r.elementType)
+	intake := reflect.MakeChan(chanType, 0)
+	output := reflect.MakeChan(chanType, 0)
+	go Config{QueueSize: route.Buffer, Overflow: route.Overflow, Stats: route.Stats}.queue(done, intake, output, nil)
+	return &activeRoute{Route: route, name: name, intake: intake}, output.Convert(reflect.ChanOf(reflect.RecvDir, r.elementType)).Interface()
+}
+
+// run receives elements from in and delivers them to the matching routes, while also
+// handling commands to change the routes.
+func (r *Router) run(done <-chan struct{}, in reflect.Value) {
+	routes := make(map[string]*activeRoute)
+	defer func() {
+		close(r.stopped)
+		for _, route := range routes {
+			route.intake.Close()
+		}
+	}()
+	handle := func(command routerCommand) {
+		if existing, ok := routes[command.name]; ok {
+			existing.intake.Close()
+			delete(routes, command.name)
+			if command.route == nil {
+				command.reply <- true
+				return
+			}
+		}
+		if command.route == nil {
+			command.reply <- false
+			return
+		}
+		route, output := r.open(done, command.name, *command.route)
+		routes[command.name] = route
+		command.reply <- output
+	}
+	const (
+		DoneChanClosed  = 0
+		CommandReceived = 1
+		InputOrRoute    = 2
+	)
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed:  {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		CommandReceived: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.commands)},
+		InputOrRoute:    {},
+	}
+	var targets []*activeRoute
+	for {
+		// receive the next element while still handling commands
+		selectConfig[InputOrRoute] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: in}
+		var (
+			caseChosen int
+			elem       reflect.Value
+			more       bool
+		)
+		for {
+			caseChosen, elem, more = reflect.Select(selectConfig)
+			if caseChosen != CommandReceived {
+				break
+			}
+			handle(elem.Interface().(routerCommand))
+		}
+		if caseChosen == DoneChanClosed || !more {
+			return
+		}
+		// find every route that wants the element, falling back to the default routes
+		targets = targets[:0]
+		for _, route := range routes {
+			if route.Match != nil && route.Match(elem.Interface()) {
+				targets = append(targets, route)
+			}
+		}
+		if len(targets) == 0 {
+			for _, route := range routes {
+				if route.Match == nil {
+					targets = append(targets, route)
+				}
+			}
+		}
+		// deliver to each of them, still handling commands while we wait
+		for _, target := range targets {
+			if routes[target.name] != target {
+				continue // removed or replaced while we delivered to another route
+			}
+			selectConfig[InputOrRoute] = reflect.SelectCase{Dir: reflect.SelectSend, Chan: target.intake, Send: elem}
+			for {
+				caseChosen, received, _ := reflect.Select(selectConfig)
+				if caseChosen == DoneChanClosed {
+					return
+				} else if caseChosen == InputOrRoute {
+					break
+				}
+				handle(received.Interface().(routerCommand))
+				if routes[target.name] != target {
+					// the route we were waiting on was removed or replaced
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func receiveInt(t *testing.T, out <-chan int) int {
+	select {
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out")
+	case elem, more := <-out:
+		if !more {
+			t.Fatalf("channel closed unexpectedly")
+		}
+		return elem
+	}
+	return 0
+}
+
+func TestRouterMatchesEveryRoute(t *testing.T) {
+	in := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	router := fan.NewRouter(done, fan.Ints().FanIn(done, in))
+	even := router.Add("even", fan.Route{
+		Match:  func(elem interface{}) bool { return elem.(int)%2 == 0 },
+		Buffer: 10,
+	}).(<-chan int)
+	small := router.Add("small", fan.Route{
+		Match:  func(elem interface{}) bool { return elem.(int) < 3 },
+		Buffer: 10,
+	}).(<-chan int)
+	other := router.Add("other", fan.Route{Buffer: 10}).(<-chan int)
+	go func() {
+		defer close(in)
+		for i := 0; i < 6; i++ {
+			in <- i
+		}
+	}()
+	expectInts(t, []int{0, 2, 4}, receiveAll(t, even))
+	expectInts(t, []int{0, 1, 2}, receiveAll(t, small))
+	expectInts(t, []int{3, 5}, receiveAll(t, other))
+}
+
+func TestRouterSlowRouteDoesNotBlock(t *testing.T) {
+	in := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	router := fan.NewRouter(done, in)
+	stats := &fan.Stats{}
+	all := func(interface{}) bool { return true }
+	router.Add("slow", fan.Route{Match: all, Buffer: 2, Overflow: fan.DropNewest, Stats: stats})
+	fast := router.Add("fast", fan.Route{Match: all}).(<-chan int)
+	for i := 0; i < 5; i++ {
+		go func(i int) { in <- i }(i)
+		receiveInt(t, fast)
+	}
+	// the slow route may still be handling the last element
+	waitForDropped(t, stats, 3)
+	if stats.Dropped() != 3 {
+		t.Fatalf("expected the slow route to drop 3 elements, dropped %d", stats.Dropped())
+	}
+}
+
+func TestRouterQueuesEveryRoute(t *testing.T) {
+	in := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	router := fan.NewRouter(done, in)
+	all := func(interface{}) bool { return true }
+	// neither route sets a buffer, but the slow one still doesn't hold up the fast one
+	slow := router.Add("slow", fan.Route{Match: all}).(<-chan int)
+	fast := router.Add("fast", fan.Route{Match: all}).(<-chan int)
+	for i := 0; i < 5; i++ {
+		go func(i int) { in <- i }(i)
+		if elem := receiveInt(t, fast); elem != i {
+			t.Fatalf("expected %d, got %d", i, elem)
+		}
+	}
+	close(in)
+	expectInts(t, []int{0, 1, 2, 3, 4}, receiveAll(t, slow))
+}
+
+func TestRouterRemove(t *testing.T) {
+	in := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	router := fan.NewRouter(done, in)
+	all := func(interface{}) bool { return true }
+	a := router.Add("a", fan.Route{Match: all, Buffer: 5}).(<-chan int)
+	b := router.Add("b", fan.Route{Match: all}).(<-chan int)
+	go func() { in <- 1 }()
+	receiveInt(t, b)
+	if !router.Remove("a") {
+		t.Fatalf("route a should have existed")
+	}
+	if router.Remove("a") {
+		t.Fatalf("route a should already have been removed")
+	}
+	// buffered elements are still delivered before the route closes
+	expectInts(t, []int{1}, receiveAll(t, a))
+	go func() { in <- 2 }()
+	if elem := receiveInt(t, b); elem != 2 {
+		t.Fatalf("expected 2, got %d", elem)
+	}
+	close(in)
+	receiveAll(t, b)
+	if _, more := <-router.Add("late", fan.Route{}).(<-chan int); more {
+		t.Fatalf("routes added after the router stops should be closed")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+)
+
+// ShardConfig configures how FanInSharded splits its output into lanes.
+type ShardConfig struct {
+	// Key returns the key of an element. All elements with the same key are sent to the
+	// same lane. It is required.
+	Key func(elem interface{}) string
+
+	// Lanes is the number of output channels. It must be positive.
+	Lanes int
+}
+
+// Lane returns the lane (in the range [0, lanes)) that elements with the given key are
+// assigned to. It uses jump consistent hashing, so when the number of lanes changes from n
+// to n+1 only about 1/(n+1) of the keys move, and they all move to the new lane.
+func Lane(key string, lanes int) int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return jumpHash(h.Sum64(), lanes)
+}
+
+// jumpHash is the algorithm from "A Fast, Minimal Memory, Consistent Hash Algorithm" by
+// Lamping and Veach.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// FanInSharded fans in the channels like FanIn, then splits the combined stream into
+// shard.Lanes output channels, sending each element to the lane chosen by Lane for its key.
+// Elements with the same key are therefore delivered in order by a single lane. Each returned
+// value is a receive-only channel with the same element type that FanIn's output would have,
+// and must be type-asserted by the caller.
+//
+// Lanes are not independent: if the consumer of one lane stops receiving, every lane stalls
+// once an element for it arrives. Configure a queue to absorb short stalls. All lanes close
+// when the fan-in's output would have closed.
+//
+// This will panic under the same conditions as FanIn, or if the shard config has no Key
+// function or fewer than one lane.
+func (c Config) FanInSharded(done <-chan struct{}, shard ShardConfig, channels ...interface{}) []interface{} {
+	if shard.Key == nil {
+		panic(fmt.Errorf("FanInSharded() called without a Key function"))
+	}
+	if shard.Lanes < 1 {
+		panic(fmt.Errorf("FanInSharded() called with %d lanes", shard.Lanes))
+	}
+	merged := reflect.ValueOf(c.FanIn(done, channels...))
+	elementType := merged.Type().Elem()
+	lanes := make([]reflect.Value, shard.Lanes)
+	outputs := make([]interface{}, shard.Lanes)
+	for i := range lanes {
+		lanes[i] = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elementType), 0)
+		outputs[i] = lanes[i].Convert(reflect.ChanOf(reflect.RecvDir, elementType)).Interface()
+	}
+	go shard.dispatch(done, merged, lanes)
+	return outputs
+}
+
+// dispatch sends each element received on in to its lane. It closes the lanes when in closes
+// or done closes.
+func (s ShardConfig) dispatch(done <-chan struct{}, in reflect.Value, lanes []reflect.Value) {
+	defer func() {
+		for _, lane := range lanes {
+			lane.Close()
+		}
+	}()
+	const (
+		DoneChanClosed = 0
+		LaneChanSent   = 1
+	)
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		LaneChanSent:   {Dir: reflect.SelectSend},
+	}
+	for {
+		elem, more := in.Recv()
+		if !more {
+			return
+		}
+		selectConfig[LaneChanSent].Chan = lanes[Lane(s.Key(elem.Interface()), len(lanes))]
+		selectConfig[LaneChanSent].Send = elem
+		if caseChosen, _, _ := reflect.Select(selectConfig); caseChosen == DoneChanClosed {
+			go drain(in)
+			return
+		}
+	}
+}
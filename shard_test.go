@@ -0,0 +1,89 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestLaneMinimalMovement(t *testing.T) {
+	const keys = 10000
+	for lanes := 1; lanes < 20; lanes++ {
+		moved := 0
+		for i := 0; i < keys; i++ {
+			key := strconv.Itoa(i)
+			before, after := fan.Lane(key, lanes), fan.Lane(key, lanes+1)
+			if before < 0 || before >= lanes {
+				t.Fatalf("key %s assigned to lane %d of %d", key, before, lanes)
+			}
+			if before != after {
+				if after != lanes {
+					t.Fatalf("key %s moved from lane %d to existing lane %d", key, before, after)
+				}
+				moved++
+			}
+		}
+		// expect about keys/(lanes+1) to move, allow generous slack
+		if expected := keys / (lanes + 1); moved > expected*3/2 || moved < expected/2 {
+			t.Fatalf("growing from %d lanes moved %d keys, expected about %d", lanes, moved, expected)
+		}
+	}
+}
+
+func TestFanInSharded(t *testing.T) {
+	a, b := make(chan string), make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	// key on the first character so that we can check per-key ordering
+	shard := fan.ShardConfig{
+		Key:   func(elem interface{}) string { return elem.(string)[:1] },
+		Lanes: 3,
+	}
+	lanes := fan.Strings().FanInSharded(done, shard, a, b)
+	if len(lanes) != 3 {
+		t.Fatalf("expected 3 lanes, got %d", len(lanes))
+	}
+	go func() {
+		defer close(a)
+		for i := 0; i < 10; i++ {
+			a <- "x" + strconv.Itoa(i)
+		}
+	}()
+	go func() {
+		defer close(b)
+		for i := 0; i < 10; i++ {
+			b <- "y" + strconv.Itoa(i)
+		}
+	}()
+	var wg sync.WaitGroup
+	results := make([][]string, len(lanes))
+	for i, lane := range lanes {
+		wg.Add(1)
+		go func(i int, lane <-chan string) {
+			defer wg.Done()
+			for elem := range lane {
+				results[i] = append(results[i], elem)
+			}
+		}(i, lane.(<-chan string))
+	}
+	wg.Wait()
+	for i, received := range results {
+		counts := map[byte]int{}
+		for _, elem := range received {
+			if fan.Lane(elem[:1], 3) != i {
+				t.Fatalf("element %s delivered to lane %d", elem, i)
+			}
+			if elem[1:] != strconv.Itoa(counts[elem[0]]) {
+				t.Fatalf("elements for key %c out of order in lane %d: %v", elem[0], i, received)
+			}
+			counts[elem[0]]++
+		}
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var reflectValueType = reflect.TypeOf(reflect.Value{})
+
+// FanInSlice is like FanIn, but takes the channels as a single slice, so that callers with a
+// []chan T or []<-chan T need not copy it into a []interface{} first. channels may be a slice
+// of any channel type, a []interface{} holding channels, or a []reflect.Value holding
+// channels.
+//
+// This will panic if channels is not a slice, or under the same conditions as FanIn.
+func (c Config) FanInSlice(done <-chan struct{}, channels interface{}) interface{} {
+	return c.FanIn(done, sliceChannels(channels)...)
+}
+
+// FanInValue is like FanIn for channels held in reflect.Values, and returns the output channel
+// as a reflect.Value. It suits callers that create channels with reflection, and so never
+// have them as concrete types.
+//
+// This will panic if a value is the zero Value, or under the same conditions as FanIn.
+func (c Config) FanInValue(done <-chan struct{}, channels ...reflect.Value) reflect.Value {
+	return reflect.ValueOf(c.FanInSlice(done, channels))
+}
+
+// sliceChannels copies the elements of a slice of channels into a []interface{}, unwrapping
+// elements that are reflect.Values.
+func sliceChannels(channels interface{}) []interface{} {
+	if channels, ok := channels.([]interface{}); ok {
+		return channels
+	}
+	t := reflect.TypeOf(channels)
+	if t == nil || t.Kind() != reflect.Slice {
+		panic(fmt.Errorf("FanInSlice() requires a slice of channels, got %v", t))
+	}
+	slice := reflect.ValueOf(channels)
+	inputs := make([]interface{}, slice.Len())
+	for i := range inputs {
+		elem := slice.Index(i)
+		if t.Elem() == reflectValueType {
+			elem = elem.Interface().(reflect.Value)
+			if !elem.IsValid() {
+				panic(fmt.Errorf("channels[%d] is the zero reflect.Value", i))
+			}
+		}
+		inputs[i] = elem.Interface()
+	}
+	return inputs
+}
@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestFanInSlice(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	bidirectional := []chan int{make(chan int), make(chan int)}
+	for i, channel := range bidirectional {
+		go func(channel chan int, elem int) {
+			defer close(channel)
+			channel <- elem
+		}(channel, i)
+	}
+	received := receiveAll(t, fan.Ints().FanInSlice(done, bidirectional).(<-chan int))
+	sort.Ints(received)
+	expectInts(t, []int{0, 1}, received)
+
+	receiveOnly := []<-chan int{sendAll(1, 2), sendAll(3)}
+	received = receiveAll(t, fan.Config{}.FanInSlice(done, receiveOnly).(<-chan int))
+	sort.Ints(received)
+	expectInts(t, []int{1, 2, 3}, received)
+}
+
+func TestFanInValue(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	// a type that only exists at run time
+	elementType := reflect.StructOf([]reflect.StructField{{Name: "N", Type: reflect.TypeOf(0)}})
+	channels := make([]reflect.Value, 3)
+	for i := range channels {
+		channels[i] = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elementType), 1)
+		elem := reflect.New(elementType).Elem()
+		elem.Field(0).SetInt(int64(i))
+		channels[i].Send(elem)
+		channels[i].Close()
+	}
+	out := fan.Config{}.FanInValue(done, channels...)
+	if out.Type() != reflect.ChanOf(reflect.RecvDir, elementType) {
+		t.Fatalf("expected output of type <-chan %v, got %v", elementType, out.Type())
+	}
+	var received []int
+	for {
+		elem, more := out.Recv()
+		if !more {
+			break
+		}
+		received = append(received, int(elem.Field(0).Int()))
+	}
+	sort.Ints(received)
+	expectInts(t, []int{0, 1, 2}, received)
+
+	// a []reflect.Value can also be passed to FanInSlice
+	received = receiveAll(t, fan.Config{}.FanInSlice(done, []reflect.Value{reflect.ValueOf(sendAll(4))}).(<-chan int))
+	expectInts(t, []int{4}, received)
+}
+
+func TestFanInSliceInvalid(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	for name, channels := range map[string]interface{}{
+		"not a slice":      make(chan int),
+		"nil":              nil,
+		"empty":            []chan int{},
+		"not channels":     []int{1, 2},
+		"send-only":        []chan<- int{make(chan int)},
+		"zero Value":       []reflect.Value{{}},
+		"mixed interfaces": []interface{}{make(chan int), make(chan string)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected FanInSlice to panic")
+				}
+			}()
+			fan.Config{}.FanInSlice(done, channels)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Source is an input to FanInAs, together with how to turn its elements into the output type.
+// At most one of SelectFunc and Convert may be set. If neither is, the channel's elements must
+// be assignable to the output type, as they are when the output type is an interface that they
+// implement, and they are sent on the output unchanged.
+type Source struct {
+	// Channel is the input channel. It must support receive.
+	Channel interface{}
+
+	// SelectFunc, if set, moves a single element from Channel to the output exactly like
+	// Config.SelectFunc, except that in has Channel's element type while out has the output
+	// type, so it converts the element while sending it. This avoids reflection entirely:
+	//
+	//	func(done <-chan struct{}, in, out interface{}) bool {
+	//		select {
+	//		case <-done:
+	//			return true
+	//		case element, more := <-in.(<-chan OrderCreated):
+	//			if !more {
+	//				return true
+	//			}
+	//			out.(chan Event) <- Event{Kind: "created", Order: element.Order}
+	//		}
+	//		return false
+	//	}
+	SelectFunc SelectFunc
+
+	// Convert, if set, converts an element of Channel into a value of the output type. The
+	// elements are received and sent with reflection. A nil result is sent as the output
+	// type's zero value.
+	Convert func(elem interface{}) interface{}
+}
+
+// FanInAs is like FanIn for input channels with different element types. Each source's elements
+// are converted into outputType as described by Source, and the returned value is a
+// receive-only channel of outputType which must be type-asserted by the caller. The Config's
+// SelectFunc is not used, since each source has its own.
+//
+// This will panic if no sources are provided, if a source's Channel is not a channel or does
+// not support receive, if a source sets both SelectFunc and Convert, if a source's elements are
+// not assignable to outputType and it sets neither, or under the same conditions as FanIn for
+// the rest of the Config.
+func (c Config) FanInAs(done <-chan struct{}, outputType reflect.Type, sources ...Source) interface{} {
+	if len(sources) < 1 {
+		panic(fmt.Errorf("FanInAs() called with no sources provided"))
+	}
+	workers := make([]worker, len(sources))
+	for i, source := range sources {
+		t := reflect.TypeOf(source.Channel)
+		if t == nil || t.Kind() != reflect.Chan {
+			panic(fmt.Errorf("sources[%d].Channel is not a channel, is %v", i, t))
+		}
+		if t.ChanDir() != reflect.BothDir && t.ChanDir() != reflect.RecvDir {
+			panic(fmt.Errorf("sources[%d].Channel does not support receive, has dir %v", i, t.ChanDir()))
+		}
+		workers[i] = worker{channel: source.Channel, loopBody: source.SelectFunc}
+		switch {
+		case source.SelectFunc != nil && source.Convert != nil:
+			panic(fmt.Errorf("sources[%d] sets both SelectFunc and Convert", i))
+		case source.Convert != nil:
+			workers[i].loopBody, workers[i].reflective = convertingSelectFunc(source.Convert, outputType), true
+		case source.SelectFunc == nil && !t.Elem().AssignableTo(outputType):
+			panic(fmt.Errorf("sources[%d] has element type %v, which is not assignable to %v", i, t.Elem(), outputType))
+		}
+	}
+	// each source moves its own elements, so they cannot be batched
+	c.batch = nil
+	return c.fanIn(done, outputType, workers)
+}
+
+// convertingSelectFunc returns a SelectFunc that works like reflectiveSelectFunc, but converts
+// each element before sending it.
+func convertingSelectFunc(convert func(interface{}) interface{}, outputType reflect.Type) SelectFunc {
+	return func(done <-chan struct{}, in, out interface{}) bool {
+		const (
+			DoneChanClosed = 0
+			InputChanRead  = 1
+		)
+		selectConfig := []reflect.SelectCase{
+			DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+			InputChanRead:  {Dir: reflect.SelectRecv, Chan: in.(reflect.Value)},
+		}
+		switch caseChosen, elem, more := reflect.Select(selectConfig); caseChosen {
+		case DoneChanClosed:
+			return true
+		case InputChanRead:
+			if !more {
+				return true
+			}
+			converted := reflect.ValueOf(convert(elem.Interface()))
+			if !converted.IsValid() {
+				converted = reflect.Zero(outputType)
+			}
+			out.(reflect.Value).Send(converted)
+		}
+		return false
+	}
+}
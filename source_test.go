@@ -0,0 +1,116 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+type event interface {
+	order() int
+}
+
+type orderCreated struct{ id int }
+type orderCancelled struct{ id int }
+
+func (o orderCreated) order() int   { return o.id }
+func (o orderCancelled) order() int { return o.id }
+
+func TestFanInAsInterface(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	created, cancelled := make(chan orderCreated), make(chan orderCancelled)
+	events := fan.Config{}.FanInAs(done, reflect.TypeOf((*event)(nil)).Elem(),
+		fan.Source{Channel: created},
+		fan.Source{Channel: (<-chan orderCancelled)(cancelled)},
+	).(<-chan event)
+	go func() {
+		created <- orderCreated{1}
+		cancelled <- orderCancelled{1}
+		close(created)
+		close(cancelled)
+	}()
+	var received []event
+	for e := range events {
+		received = append(received, e)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 events, got %v", received)
+	}
+	for _, e := range received {
+		if e.order() != 1 {
+			t.Fatalf("unexpected event %v", e)
+		}
+	}
+}
+
+func TestFanInAsConverters(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	ints, strings, floats := make(chan int), make(chan string), make(chan float64)
+	output := fan.Config{}.FanInAs(done, reflect.TypeOf(""),
+		fan.Source{Channel: ints, SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+			select {
+			case <-done:
+				return true
+			case element, more := <-in.(<-chan int):
+				if !more {
+					return true
+				}
+				out.(chan string) <- strconv.Itoa(element)
+			}
+			return false
+		}},
+		fan.Source{Channel: strings},
+		fan.Source{Channel: floats, Convert: func(elem interface{}) interface{} {
+			return strconv.FormatFloat(elem.(float64), 'f', 1, 64)
+		}},
+	).(<-chan string)
+	go func() {
+		ints <- 1
+		strings <- "two"
+		floats <- 3
+		close(ints)
+		close(strings)
+		close(floats)
+	}()
+	var received []string
+	for elem := range output {
+		received = append(received, elem)
+	}
+	sort.Strings(received)
+	if !reflect.DeepEqual(received, []string{"1", "3.0", "two"}) {
+		t.Fatalf("unexpected output %v", received)
+	}
+}
+
+func TestFanInAsPanics(t *testing.T) {
+	for name, sources := range map[string][]fan.Source{
+		"None":          nil,
+		"NotChannel":    {{Channel: 1}},
+		"SendOnly":      {{Channel: make(chan<- string)}},
+		"NotAssignable": {{Channel: make(chan int)}},
+		"Both": {{
+			Channel:    make(chan int),
+			SelectFunc: fan.Ints().SelectFunc,
+			Convert:    func(elem interface{}) interface{} { return "" },
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic")
+				}
+			}()
+			fan.Config{}.FanInAs(nil, reflect.TypeOf(""), sources...)
+		})
+	}
+}
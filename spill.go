@@ -0,0 +1,266 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// Codec converts elements to and from bytes so that they can be stored on disk.
+type Codec interface {
+	// Marshal encodes an element.
+	Marshal(elem interface{}) ([]byte, error)
+	// Unmarshal decodes an element previously encoded by Marshal. The returned value must
+	// be assignable to the element type of the channels being fanned in. Implementations
+	// may retain data.
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// BytesCodec is a Codec for channels with byte slice as their element type.
+type BytesCodec struct{}
+
+// Marshal returns elem, which must be a []byte.
+func (BytesCodec) Marshal(elem interface{}) ([]byte, error) {
+	b, ok := elem.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("BytesCodec cannot marshal %T", elem)
+	}
+	return b, nil
+}
+
+// Unmarshal returns data.
+func (BytesCodec) Unmarshal(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+// SpillConfig configures a queue that writes elements to disk once it holds QueueSize
+// of them in memory.
+type SpillConfig struct {
+	// Dir is the directory in which segment files are created. Each fan-in creates
+	// (and removes when it finishes) its own subdirectory, so several fan-ins may share
+	// the same Dir. If it is empty, the default directory for temporary files is used.
+	Dir string
+
+	// Codec encodes elements to and from the segment files. It is required.
+	Codec Codec
+
+	// SegmentSize is the number of elements written to a segment file before a new one
+	// is started. Segments are deleted once all of their elements have been read back.
+	// If it is not positive, DefaultSegmentSize is used.
+	SegmentSize int
+
+	// OnError, if set, is called from the queue's goroutine with any error encountered
+	// while writing or reading a segment. The element involved is dropped and counted in
+	// the Config's Stats.
+	OnError func(error)
+}
+
+// DefaultSegmentSize is the number of elements per segment file used when
+// SpillConfig.SegmentSize is not set.
+const DefaultSegmentSize = 4096
+
+func (c *SpillConfig) report(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+// spill is a FIFO of elements stored in segment files.
+type spill struct {
+	SpillConfig
+	elementType reflect.Type
+	dir         string
+	size        int
+
+	// segments holds every segment that has not been fully read, oldest first
+	segments []segment
+	next     uint64
+
+	writeFile *os.File
+	writer    *bufio.Writer
+	readFile  *os.File
+	reader    *bufio.Reader
+}
+
+// segment tracks a segment file, the number of elements written to it, and the number of
+// those that have not been read.
+type segment struct {
+	seq            uint64
+	written, count int
+}
+
+func (c SpillConfig) open(elementType reflect.Type) (*spill, error) {
+	if c.Codec == nil {
+		return nil, fmt.Errorf("spill queue requires a Codec")
+	}
+	if c.SegmentSize <= 0 {
+		c.SegmentSize = DefaultSegmentSize
+	}
+	dir, err := ioutil.TempDir(c.Dir, "fan-spill-")
+	if err != nil {
+		return nil, fmt.Errorf("failed creating spill directory: %w", err)
+	}
+	return &spill{SpillConfig: c, elementType: elementType, dir: dir}, nil
+}
+
+func (s *spill) len() int { return s.size }
+
+func (s *spill) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d.seg", seq))
+}
+
+// push appends elem to the newest segment, starting a new one if necessary.
+func (s *spill) push(elem reflect.Value) error {
+	data, err := s.Codec.Marshal(elem.Interface())
+	if err != nil {
+		return fmt.Errorf("failed marshaling element for spill: %w", err)
+	}
+	if s.writeFile == nil || s.segments[len(s.segments)-1].written >= s.SegmentSize {
+		if err := s.seal(); err != nil {
+			return err
+		}
+		f, err := os.Create(s.segmentPath(s.next))
+		if err != nil {
+			return fmt.Errorf("failed creating spill segment: %w", err)
+		}
+		s.writeFile, s.writer = f, bufio.NewWriter(f)
+		s.segments = append(s.segments, segment{seq: s.next})
+		s.next++
+	}
+	var header [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], uint64(len(data)))
+	if _, err := s.writer.Write(header[:n]); err != nil {
+		return fmt.Errorf("failed writing spill segment: %w", err)
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		return fmt.Errorf("failed writing spill segment: %w", err)
+	}
+	s.segments[len(s.segments)-1].written++
+	s.segments[len(s.segments)-1].count++
+	s.size++
+	return nil
+}
+
+// seal finishes the segment currently being written, if any.
+func (s *spill) seal() error {
+	if s.writeFile == nil {
+		return nil
+	}
+	defer func() { s.writeFile, s.writer = nil, nil }()
+	if err := s.writer.Flush(); err != nil {
+		s.writeFile.Close()
+		return fmt.Errorf("failed flushing spill segment: %w", err)
+	}
+	if err := s.writeFile.Close(); err != nil {
+		return fmt.Errorf("failed closing spill segment: %w", err)
+	}
+	return nil
+}
+
+// pop removes and returns the oldest element. It must not be called when len() is zero.
+// If the element cannot be read, the rest of its segment is unreadable as well, so the
+// whole segment is discarded and lost reports how many elements were lost with it. Errors
+// may also be returned alongside a valid element if cleaning up a segment fails.
+func (s *spill) pop() (elem reflect.Value, lost int, err error) {
+	head := &s.segments[0]
+	// the segment that is still being written is read through a handle of its own, which
+	// keeps its offset while the writer appends, once its buffered elements are flushed
+	writing := len(s.segments) == 1 && s.writeFile != nil
+	if writing {
+		if err = s.writer.Flush(); err != nil {
+			err = fmt.Errorf("failed flushing spill segment: %w", err)
+		}
+	}
+	if err == nil && s.reader == nil {
+		if s.readFile, err = os.Open(s.segmentPath(head.seq)); err != nil {
+			err = fmt.Errorf("failed opening spill segment: %w", err)
+		} else {
+			s.reader = bufio.NewReader(s.readFile)
+		}
+	}
+	if err != nil {
+		lost = head.count
+		s.size -= head.count
+		head.count = 0
+		s.discard()
+		return reflect.Value{}, lost, err
+	}
+	elem, err = s.read()
+	head.count--
+	s.size--
+	if err != nil {
+		lost = 1 + head.count
+		s.size -= head.count
+		head.count = 0
+	}
+	// keep appending to a drained segment that has room rather than starting a new one
+	if head.count == 0 && (err != nil || !writing || head.written >= s.SegmentSize) {
+		if discardErr := s.discard(); err == nil {
+			err = discardErr
+		}
+	}
+	return elem, lost, err
+}
+
+func (s *spill) read() (reflect.Value, error) {
+	length, err := binary.ReadUvarint(s.reader)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("failed reading spill segment: %w", err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return reflect.Value{}, fmt.Errorf("failed reading spill segment: %w", err)
+	}
+	elem, err := s.Codec.Unmarshal(data)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("failed unmarshaling spilled element: %w", err)
+	}
+	value := reflect.ValueOf(elem)
+	if !value.IsValid() {
+		return reflect.Zero(s.elementType), nil
+	}
+	if !value.Type().AssignableTo(s.elementType) {
+		return reflect.Value{}, fmt.Errorf("codec produced %v, which is not assignable to %v", value.Type(), s.elementType)
+	}
+	return value, nil
+}
+
+// discard closes and deletes the oldest segment, which may be the one being written.
+func (s *spill) discard() error {
+	if s.readFile != nil {
+		s.readFile.Close()
+	}
+	s.readFile, s.reader = nil, nil
+	if len(s.segments) == 1 && s.writeFile != nil {
+		s.writeFile.Close()
+		s.writeFile, s.writer = nil, nil
+	}
+	seq := s.segments[0].seq
+	s.segments = s.segments[1:]
+	if err := os.Remove(s.segmentPath(seq)); err != nil {
+		return fmt.Errorf("failed removing spill segment: %w", err)
+	}
+	return nil
+}
+
+// close releases all files and removes the spill directory.
+func (s *spill) close() {
+	if s.readFile != nil {
+		s.readFile.Close()
+	}
+	if s.writeFile != nil {
+		s.writeFile.Close()
+	}
+	os.RemoveAll(s.dir)
+}
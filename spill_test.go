@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestSpillPreservesOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := fan.ByteSlices()
+	config.QueueSize = 4
+	config.Spill = &fan.SpillConfig{
+		Dir:         dir,
+		Codec:       fan.BytesCodec{},
+		SegmentSize: 10,
+		OnError: func(err error) {
+			t.Errorf("unexpected spill error: %v", err)
+		},
+	}
+	in := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	out := config.FanIn(done, in).(<-chan []byte)
+
+	// send far more than the queue can hold in memory without reading any output
+	const total = 105
+	for i := 0; i < total; i++ {
+		select {
+		case <-time.NewTicker(time.Second).C:
+			t.Fatalf("timed out sending element %d", i)
+		case in <- []byte(strconv.Itoa(i)):
+		}
+	}
+	close(in)
+
+	for i := 0; i < total; i++ {
+		select {
+		case <-time.NewTicker(time.Second).C:
+			t.Fatalf("timed out receiving element %d", i)
+		case elem := <-out:
+			if string(elem) != strconv.Itoa(i) {
+				t.Fatalf("expected element %d, got %s", i, elem)
+			}
+		}
+	}
+	if _, more := <-out; more {
+		t.Fatalf("channel is not closed after input channel closed")
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected spill directory to be cleaned up, found %d entries", len(entries))
+	}
+}
+
+func TestSpillReadsSegmentBeingWritten(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := fan.ByteSlices()
+	config.QueueSize = 1
+	config.Spill = &fan.SpillConfig{
+		Dir:         dir,
+		Codec:       fan.BytesCodec{},
+		SegmentSize: 100,
+		OnError: func(err error) {
+			t.Errorf("unexpected spill error: %v", err)
+		},
+	}
+	in := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	out := config.FanIn(done, in).(<-chan []byte)
+	send := func(i int) {
+		select {
+		case <-time.After(testTimeout):
+			t.Fatalf("timed out sending element %d", i)
+		case in <- []byte(strconv.Itoa(i)):
+		}
+	}
+	for i := 0; i < 4; i++ {
+		send(i)
+	}
+	// hover above the in-memory capacity, so that every element read from disk is replaced
+	// by one written to it
+	for i := 0; i < 20; i++ {
+		select {
+		case <-time.After(testTimeout):
+			t.Fatalf("timed out receiving element %d", i)
+		case elem := <-out:
+			if string(elem) != strconv.Itoa(i) {
+				t.Fatalf("expected element %d, got %s", i, elem)
+			}
+		}
+		send(i + 4)
+	}
+	// all of those elements fit in the first segment, so no other should have been started
+	spills, err := ioutil.ReadDir(dir)
+	if err != nil || len(spills) != 1 {
+		t.Fatalf("expected one spill directory, got %d (%v)", len(spills), err)
+	}
+	segments, err := ioutil.ReadDir(filepath.Join(dir, spills[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range segments {
+		if segment.Name() != fmt.Sprintf("%020d.seg", 0) {
+			t.Fatalf("expected only the first segment, found %s", segment.Name())
+		}
+	}
+}
+
+type failingCodec struct{}
+
+func (failingCodec) Marshal(elem interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("cannot marshal %v", elem)
+}
+
+func (failingCodec) Unmarshal(data []byte) (interface{}, error) {
+	return nil, fmt.Errorf("cannot unmarshal")
+}
+
+func TestSpillCodecError(t *testing.T) {
+	var errs int
+	stats := &fan.Stats{}
+	config := fan.Config{
+		QueueSize: 2,
+		Spill: &fan.SpillConfig{
+			Codec:   failingCodec{},
+			OnError: func(error) { errs++ },
+		},
+		Stats: stats,
+	}
+	out, in := fillQueue(t, config, 5)
+	waitForDropped(t, stats, 3)
+	close(in)
+	expectInts(t, []int{0, 1}, receiveAll(t, out))
+	if stats.Dropped() != 3 || errs != 3 {
+		t.Fatalf("expected 3 dropped elements and errors, got %d and %d", stats.Dropped(), errs)
+	}
+}
+
+func TestSpillRequiresCodec(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatalf("should have panicked without a codec")
+		}
+	}()
+	config := fan.Config{QueueSize: 1, Spill: &fan.SpillConfig{}}
+	config.FanIn(make(chan struct{}), make(chan int))
+}
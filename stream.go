@@ -0,0 +1,159 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrCancelled is reported by Stream.Err when a fan-in ended because its done channel
+	// closed.
+	ErrCancelled = errors.New("fan-in cancelled by its done channel")
+
+	// ErrStreamClosed is returned by Stream.Recv once the stream's output has closed.
+	ErrStreamClosed = errors.New("fan-in output closed")
+)
+
+// Stream is a handle to a running fan-in whose output has element type T. It is safe for
+// concurrent use, but like any channel its elements are each received by only one consumer.
+type Stream[T any] struct {
+	output   <-chan T
+	finished chan struct{}
+	err      error
+
+	mutex sync.Mutex
+	// panicked is the first panic recovered from a worker
+	panicked *PanicError
+}
+
+// FanInStream fans in the channels exactly as c.FanIn would, but returns a Stream instead of
+// a channel that must be type-asserted. If c has no SelectFunc, one specialized to T is used
+// instead of reflection. This will panic under the same conditions as FanIn, or if c sets Ack
+// or Envelope, since those change the element type.
+func FanInStream[T any](c Config, done <-chan struct{}, channels ...<-chan T) *Stream[T] {
+	if c.Ack != nil || c.Envelope != nil {
+		panic(fmt.Errorf("FanInStream() cannot use a Config that sets Ack or Envelope"))
+	}
+	if c.SelectFunc == nil {
+		c.SelectFunc = selectFunc[T]
+	}
+	inputs := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		inputs[i] = channel
+	}
+	elementType := checkChannels("FanInStream", inputs)
+	if err := c.checkBatch(elementType); err != nil {
+		panic(err)
+	}
+	s := &Stream[T]{finished: make(chan struct{})}
+	if c.Recover != nil {
+		// remember the first panic so that Err can report it
+		recoverConfig, onPanic := *c.Recover, c.Recover.OnPanic
+		recoverConfig.OnPanic = func(err *PanicError) {
+			s.mutex.Lock()
+			if s.panicked == nil {
+				s.panicked = err
+			}
+			s.mutex.Unlock()
+			if onPanic != nil {
+				onPanic(err)
+			}
+		}
+		c.Recover = &recoverConfig
+	}
+	p := c.pipeline(done, elementType)
+	c.run(done, p, c.workers(inputs), func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		// the workers only stop early once done has closed, or after a panic
+		select {
+		case <-done:
+			s.err = ErrCancelled
+		default:
+		}
+		if s.panicked != nil {
+			s.err = s.panicked
+		}
+		close(s.finished)
+		p.close()
+	})
+	s.output = p.output.(<-chan T)
+	return s
+}
+
+// C returns the fan-in's output channel.
+func (s *Stream[T]) C() <-chan T {
+	return s.output
+}
+
+// Recv receives the next element. It returns ctx.Err() if ctx is done first, or
+// ErrStreamClosed if the output has closed.
+func (s *Stream[T]) Recv(ctx context.Context) (T, error) {
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case elem, more := <-s.output:
+		if !more {
+			return elem, ErrStreamClosed
+		}
+		return elem, nil
+	}
+}
+
+// Range calls f with each element until f returns false or the output closes. Returning false
+// does not stop the fan-in; close its done channel to do that.
+func (s *Stream[T]) Range(f func(elem T) bool) {
+	for elem := range s.output {
+		if !f(elem) {
+			return
+		}
+	}
+}
+
+// Wait blocks until every worker of the fan-in has exited. Elements that they had already
+// sent may still be waiting to be received, for example in a queue.
+func (s *Stream[T]) Wait() {
+	<-s.finished
+}
+
+// Err describes why the fan-in ended: it is the first *PanicError recovered from a worker if
+// the Config sets Recover and one panicked, ErrCancelled if the done channel closed, or nil if
+// every input closed. It is also nil while the fan-in is running.
+func (s *Stream[T]) Err() error {
+	select {
+	case <-s.finished:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// selectFunc is a SelectFunc for channels with element type T.
+func selectFunc[T any](done <-chan struct{}, in, out interface{}) bool {
+	select {
+	case <-done:
+		return true
+	case element, more := <-in.(<-chan T):
+		if !more {
+			return true
+		}
+		select {
+		case <-done:
+			return true
+		case out.(chan T) <- element:
+		}
+	}
+	return false
+}
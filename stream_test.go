@@ -0,0 +1,79 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestStream(t *testing.T) {
+	for name, config := range map[string]fan.Config{"Generic": {}, "Ints": fan.Ints()} {
+		t.Run(name, func(t *testing.T) {
+			stream := fan.FanInStream(config, nil, sendAll(1, 2), sendAll(3))
+			var received []int
+			stream.Range(func(elem int) bool {
+				received = append(received, elem)
+				return true
+			})
+			sort.Ints(received)
+			expectInts(t, received, []int{1, 2, 3})
+			stream.Wait()
+			if err := stream.Err(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if _, err := stream.Recv(context.Background()); err != fan.ErrStreamClosed {
+				t.Fatalf("expected ErrStreamClosed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStreamCancelled(t *testing.T) {
+	done := make(chan struct{})
+	input := make(chan int)
+	stream := fan.FanInStream(fan.Config{}, done, input)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+	defer cancel()
+	if _, err := stream.Recv(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the context to time out, got %v", err)
+	}
+	go func() { input <- 1 }()
+	if elem, err := stream.Recv(context.Background()); err != nil || elem != 1 {
+		t.Fatalf("expected 1, got %d and %v", elem, err)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("expected no error while running, got %v", err)
+	}
+	close(done)
+	stream.Wait()
+	if err := stream.Err(); err != fan.ErrCancelled {
+		t.Fatalf("expected ErrCancelled, got %v", err)
+	}
+	for range stream.C() {
+	}
+}
+
+func TestStreamPanic(t *testing.T) {
+	stream := fan.FanInStream(fan.Config{
+		SelectFunc: unlucky,
+		Recover:    &fan.RecoverConfig{StopAll: true},
+	}, nil, make(chan int), sendAll(13))
+	for range stream.C() {
+	}
+	stream.Wait()
+	if err, ok := stream.Err().(*fan.PanicError); !ok || err.Input != 1 {
+		t.Fatalf("expected a panic from input 1, got %v", stream.Err())
+	}
+}
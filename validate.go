@@ -0,0 +1,71 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+// Validate checks that the config's SelectFunc works with channels of elementType. It calls
+// the SelectFunc once with a closed, empty input channel of that type, and reports an error
+// naming both types if the SelectFunc makes a type assertion on its input that fails, or an
+// error if it panics or does not stop. The SelectFunc is never passed an element, so it cannot
+// check the type assertion on its output. A config without a SelectFunc is always valid, unless
+// it is batched (see Batched) for a different element type or sets Ack or Envelope as well.
+//
+// FanIn and the other fan-in methods do not call Validate, so that the SelectFunc only ever
+// sees real inputs and each fan-in stays cheap. Plan and Register do, and it can be called
+// directly, for example from a test. The fanvet analyzer checks SelectFuncs at build time.
+func (c Config) Validate(elementType reflect.Type) error {
+	if err := c.checkBatch(elementType); err != nil {
+		return err
+	}
+	if c.SelectFunc == nil {
+		return nil
+	}
+	return validateSelectFunc(c.SelectFunc, elementType)
+}
+
+// checkBatch checks that a batched config is batched for elementType and sets neither Ack nor
+// Envelope, whose outputs are not channels of elements to unbatch into. Unlike Validate it calls
+// no user code, so the fan-in methods call it every time.
+func (c Config) checkBatch(elementType reflect.Type) error {
+	if c.batch != nil && (c.Ack != nil || c.Envelope != nil) {
+		return fmt.Errorf("batched configs cannot set Ack or Envelope")
+	}
+	if c.batch != nil && c.batch.elementType() != elementType {
+		return fmt.Errorf("config is batched for element type %v, which cannot be used with channels of element type %v", c.batch.elementType(), elementType)
+	}
+	return nil
+}
+
+// validateSelectFunc checks that f stops, without panicking, when it receives from a closed
+// channel of elementType.
+func validateSelectFunc(f SelectFunc, elementType reflect.Type) (err error) {
+	in := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elementType), 0)
+	in.Close()
+	inChan := in.Convert(reflect.ChanOf(reflect.RecvDir, elementType)).Interface()
+	// a well-behaved SelectFunc never sends, but one that ignores the closed input should not
+	// block forever
+	outChan := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elementType), 1).Interface()
+	done := make(chan struct{})
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if _, ok := recovered.(*runtime.TypeAssertionError); ok {
+				err = fmt.Errorf("SelectFunc cannot be used with channels of element type %v: %v", elementType, recovered)
+			} else {
+				err = fmt.Errorf("SelectFunc for element type %v panicked when its input closed: %v", elementType, recovered)
+			}
+		}
+	}()
+	if !f(done, inChan, outChan) {
+		return fmt.Errorf("SelectFunc for element type %v did not stop when its input closed", elementType)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func TestValidate(t *testing.T) {
+	for elementType, config := range map[reflect.Type]fan.Config{
+		reflect.TypeOf(0):                          fan.Ints(),
+		reflect.TypeOf(""):                         fan.Strings(),
+		reflect.TypeOf([]byte(nil)):                fan.ByteSlices(),
+		reflect.TypeOf((*interface{})(nil)).Elem(): fan.Interfaces(),
+		reflect.TypeOf(struct{}{}):                 {},
+	} {
+		if err := config.Validate(elementType); err != nil {
+			t.Fatalf("unexpected error for %v: %v", elementType, err)
+		}
+	}
+	err := fan.Ints().Validate(reflect.TypeOf(""))
+	if err == nil || !strings.Contains(err.Error(), "<-chan string") || !strings.Contains(err.Error(), "<-chan int") {
+		t.Fatalf("expected an error naming both types, got %v", err)
+	}
+	endless := fan.Config{SelectFunc: func(done <-chan struct{}, in, out interface{}) bool {
+		<-in.(<-chan int)
+		return false
+	}}
+	if err := endless.Validate(reflect.TypeOf(0)); err == nil {
+		t.Fatalf("expected an error for a SelectFunc that never stops")
+	}
+	if err := fan.Ints().Validate(reflect.TypeOf(0)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// countingSelectFunc moves ints like fan.Ints(), and counts the elements it receives.
+func countingSelectFunc(received *int32) fan.SelectFunc {
+	return func(done <-chan struct{}, in, out interface{}) bool {
+		select {
+		case <-done:
+			return true
+		case element, more := <-in.(<-chan int):
+			if !more {
+				return true
+			}
+			atomic.AddInt32(received, 1)
+			out.(chan int) <- element
+		}
+		return false
+	}
+}
+
+func TestValidateSendsNoElements(t *testing.T) {
+	var received int32
+	config := fan.Config{SelectFunc: countingSelectFunc(&received)}
+	if err := config.Validate(reflect.TypeOf(0)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	config.Plan(make(chan int), 1)
+	if received := atomic.LoadInt32(&received); received != 0 {
+		t.Fatalf("SelectFunc received %d elements that were never sent", received)
+	}
+}
+
+func TestFanInDoesNotValidate(t *testing.T) {
+	var received int32
+	done := make(chan struct{})
+	defer close(done)
+	config := fan.Config{SelectFunc: countingSelectFunc(&received)}
+	expectInts(t, []int{1, 2}, receiveAll(t, config.FanIn(done, sendAll(1, 2)).(<-chan int)))
+	if received := atomic.LoadInt32(&received); received != 2 {
+		t.Fatalf("SelectFunc should only have received the 2 elements sent, received %d", received)
+	}
+}
+
+func TestPlanValidates(t *testing.T) {
+	defer func() {
+		if recovered := recover(); recovered == nil || !strings.Contains(fmt.Sprint(recovered), "string") {
+			t.Fatalf("expected a panic naming the element type, got %v", recovered)
+		}
+	}()
+	fan.Ints().Plan(make(chan string), 1)
+}
@@ -0,0 +1,565 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy determines when a WAL forces appended records onto stable storage.
+type SyncPolicy int
+
+const (
+	// SyncEvery syncs the log after every appended element. This is the default.
+	SyncEvery SyncPolicy = iota
+	// SyncInterval syncs the log periodically, as configured by WALConfig.FsyncInterval.
+	SyncInterval
+	// SyncNever leaves syncing to the operating system.
+	SyncNever
+)
+
+// WALConfig configures a write-ahead log.
+type WALConfig struct {
+	// Dir is the directory holding the log's segment files and its committed offset. It
+	// is created if it does not exist. Only one WAL may use a directory at a time.
+	Dir string
+
+	// Codec encodes elements to and from the log. It is required.
+	Codec Codec
+
+	// SegmentBytes is the size a segment file may reach before a new one is started. If
+	// it is not positive, DefaultWALSegmentBytes is used.
+	SegmentBytes int64
+
+	// Fsync determines when appended elements are synced to disk.
+	Fsync SyncPolicy
+
+	// FsyncInterval is how often the log is synced under the SyncInterval policy. If it is
+	// not positive, one second is used.
+	FsyncInterval time.Duration
+
+	// OnError, if set, is called with errors encountered while appending to or replaying
+	// the log. A fan-in still delivers elements that it failed to append.
+	OnError func(error)
+}
+
+// DefaultWALSegmentBytes is the segment size used when WALConfig.SegmentBytes is not set.
+const DefaultWALSegmentBytes = 64 << 20
+
+const (
+	walSegmentSuffix = ".wal"
+	walCommitFile    = "committed"
+	// each record is its sequence number, the length of its data, and a checksum of its
+	// data, followed by the data itself
+	walHeaderSize = 8 + 4 + 4
+)
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WAL is a write-ahead log of elements received by fan-in workers. Set it as the WAL of a
+// Config and every element the fan-in receives will be assigned the next sequence number and
+// appended to the log before it is delivered. After a crash, Replay returns every element
+// that was appended after the last committed sequence number.
+//
+// Delivered elements do not carry their sequence numbers, and since a queue may drop elements
+// and a WAL may be shared, consumers cannot count them either. Set the Config's Envelope too,
+// and each Envelope's WALSeq will hold the sequence number to pass to Commit.
+//
+// A WAL is safe for concurrent use, and may be shared by several fan-ins of the same element
+// type.
+type WAL struct {
+	WALConfig
+
+	mu        sync.Mutex
+	segments  []uint64 // first sequence number of each segment, oldest first
+	file      *os.File
+	writer    *bufio.Writer
+	written   int64 // bytes in the current segment
+	last      uint64
+	committed uint64
+	dirty     bool
+	closed    chan struct{}
+}
+
+// OpenWAL opens the log in config.Dir, creating it if necessary. A partially written record
+// at the end of the log (as left behind by a crash) is discarded.
+func OpenWAL(config WALConfig) (*WAL, error) {
+	if config.Codec == nil {
+		return nil, fmt.Errorf("WAL requires a Codec")
+	}
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = DefaultWALSegmentBytes
+	}
+	if config.FsyncInterval <= 0 {
+		config.FsyncInterval = time.Second
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed creating WAL directory: %w", err)
+	}
+	w := &WAL{WALConfig: config, closed: make(chan struct{})}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	if config.Fsync == SyncInterval {
+		go w.syncPeriodically()
+	}
+	return w, nil
+}
+
+// load discovers the existing segments and committed offset and prepares the newest segment
+// for appending.
+func (w *WAL) load() error {
+	data, err := ioutil.ReadFile(filepath.Join(w.Dir, walCommitFile))
+	if err == nil {
+		if w.committed, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return fmt.Errorf("failed parsing WAL committed offset: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed reading WAL committed offset: %w", err)
+	}
+	w.last = w.committed
+	entries, err := ioutil.ReadDir(w.Dir)
+	if err != nil {
+		return fmt.Errorf("failed listing WAL directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, walSegmentSuffix) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, first)
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i] < w.segments[j] })
+	if len(w.segments) == 0 {
+		return nil
+	}
+	// find the last intact record in the newest segment and drop anything after it
+	newest := w.segments[len(w.segments)-1]
+	if newest-1 > w.last {
+		w.last = newest - 1
+	}
+	f, err := os.OpenFile(w.segmentPath(newest), os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed opening WAL segment: %w", err)
+	}
+	var valid int64
+	reader := bufio.NewReader(f)
+	for {
+		seq, data, err := readWALRecord(reader)
+		if err != nil {
+			break
+		}
+		valid += walHeaderSize + int64(len(data))
+		w.last = seq
+	}
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return fmt.Errorf("failed truncating WAL segment: %w", err)
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return fmt.Errorf("failed seeking WAL segment: %w", err)
+	}
+	w.file, w.writer, w.written = f, bufio.NewWriter(f), valid
+	return nil
+}
+
+func (w *WAL) segmentPath(first uint64) string {
+	return filepath.Join(w.Dir, fmt.Sprintf("%020d%s", first, walSegmentSuffix))
+}
+
+func (w *WAL) report(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// Last returns the sequence number of the most recently appended element. Sequence numbers
+// start at 1, so Last returns 0 for an empty log.
+func (w *WAL) Last() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+// Committed returns the sequence number most recently passed to Commit.
+func (w *WAL) Committed() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.committed
+}
+
+// Append assigns elem the next sequence number and writes it to the log according to the
+// configured SyncPolicy. Fan-ins call this for every element they receive, so most callers
+// never need to.
+func (w *WAL) Append(elem interface{}) (uint64, error) {
+	data, err := w.Codec.Marshal(elem)
+	if err != nil {
+		return 0, fmt.Errorf("failed marshaling element for WAL: %w", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.closed:
+		return 0, fmt.Errorf("WAL is closed")
+	default:
+	}
+	seq := w.last + 1
+	if w.file == nil || w.written >= w.SegmentBytes {
+		if err := w.rotate(seq); err != nil {
+			return 0, err
+		}
+	}
+	var header [walHeaderSize]byte
+	binary.BigEndian.PutUint64(header[0:8], seq)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[12:16], crc32.Checksum(data, walTable))
+	if _, err := w.writer.Write(header[:]); err != nil {
+		return 0, fmt.Errorf("failed writing WAL record: %w", err)
+	}
+	if _, err := w.writer.Write(data); err != nil {
+		return 0, fmt.Errorf("failed writing WAL record: %w", err)
+	}
+	w.written += walHeaderSize + int64(len(data))
+	w.last = seq
+	w.dirty = true
+	switch w.Fsync {
+	case SyncEvery:
+		if err := w.sync(); err != nil {
+			return seq, err
+		}
+	case SyncNever:
+		// hand the record to the operating system so that it survives a crash of this process
+		if err := w.writer.Flush(); err != nil {
+			return seq, fmt.Errorf("failed flushing WAL: %w", err)
+		}
+	}
+	return seq, nil
+}
+
+// rotate finishes the current segment and starts a new one whose first record will be first.
+// It must be called with w.mu held.
+func (w *WAL) rotate(first uint64) error {
+	if w.file != nil {
+		if err := w.sync(); err != nil {
+			return err
+		}
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("failed closing WAL segment: %w", err)
+		}
+		w.file, w.writer = nil, nil
+	}
+	f, err := os.OpenFile(w.segmentPath(first), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed creating WAL segment: %w", err)
+	}
+	w.file, w.writer, w.written = f, bufio.NewWriter(f), 0
+	w.segments = append(w.segments, first)
+	return nil
+}
+
+// sync flushes buffered records and syncs the current segment. It must be called with w.mu
+// held.
+func (w *WAL) sync() error {
+	if w.file == nil || !w.dirty {
+		return nil
+	}
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("failed flushing WAL: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed syncing WAL: %w", err)
+	}
+	w.dirty = false
+	return nil
+}
+
+// Sync forces every appended element onto stable storage, regardless of SyncPolicy.
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sync()
+}
+
+func (w *WAL) syncPeriodically() {
+	ticker := time.NewTicker(w.FsyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.closed:
+			return
+		case <-ticker.C:
+			if err := w.Sync(); err != nil {
+				w.report(err)
+			}
+		}
+	}
+}
+
+// Commit records that every element with a sequence number up to and including seq has been
+// fully processed, so that Replay will not return them again. Segments that contain only
+// committed elements are deleted. The committed offset is synced to disk before Commit
+// returns.
+//
+// Commit covers every earlier sequence number, so if a WAL is shared by several fan-ins, or
+// elements are processed out of order, only commit a sequence number once every element
+// before it has been processed as well.
+func (w *WAL) Commit(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seq <= w.committed {
+		return nil
+	}
+	if seq > w.last {
+		return fmt.Errorf("cannot commit sequence number %d, last appended is %d", seq, w.last)
+	}
+	if err := w.writeCommitted(seq); err != nil {
+		return err
+	}
+	w.committed = seq
+	// a segment is fully committed if the one after it starts at or before the next
+	// uncommitted sequence number. The newest segment is never removed.
+	for len(w.segments) > 1 && w.segments[1] <= seq+1 {
+		if err := os.Remove(w.segmentPath(w.segments[0])); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed removing WAL segment: %w", err)
+		}
+		w.segments = w.segments[1:]
+	}
+	return nil
+}
+
+// writeCommitted durably replaces the committed offset with seq, by syncing it to a new file,
+// renaming that over the old one, and syncing the directory so that the rename survives a
+// crash.
+func (w *WAL) writeCommitted(seq uint64) error {
+	path := filepath.Join(w.Dir, walCommitFile)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed writing WAL committed offset: %w", err)
+	}
+	if _, err := f.Write([]byte(strconv.FormatUint(seq, 10) + "\n")); err != nil {
+		f.Close()
+		return fmt.Errorf("failed writing WAL committed offset: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed syncing WAL committed offset: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed writing WAL committed offset: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed writing WAL committed offset: %w", err)
+	}
+	dir, err := os.Open(w.Dir)
+	if err != nil {
+		return fmt.Errorf("failed syncing WAL directory: %w", err)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed syncing WAL directory: %w", err)
+	}
+	return nil
+}
+
+// Replay returns a receive-only channel with the given element type (which must be
+// type-asserted by the caller, just like the result of Config.FanIn) that yields every
+// element appended after the committed offset, up to the last element appended before
+// Replay was called, in sequence order. The first element's sequence number is one more than
+// what Committed returned before Replay was called. Each element after it has the next
+// sequence number. The channel closes after the last such element or when done closes.
+// Errors reading the log are reported to OnError and end the replay.
+func (w *WAL) Replay(done <-chan struct{}, elementType reflect.Type) interface{} {
+	var err error
+	w.mu.Lock()
+	if w.writer != nil {
+		err = w.writer.Flush()
+	}
+	segments := append([]uint64(nil), w.segments...)
+	from, through := w.committed+1, w.last
+	w.mu.Unlock()
+
+	output := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elementType), 0)
+	go func() {
+		defer output.Close()
+		if err != nil {
+			w.report(fmt.Errorf("failed flushing WAL: %w", err))
+			return
+		}
+		const (
+			DoneChanClosed = 0
+			OutputChanSent = 1
+		)
+		selectConfig := []reflect.SelectCase{
+			DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+			OutputChanSent: {Dir: reflect.SelectSend, Chan: output},
+		}
+		for i, first := range segments {
+			if i+1 < len(segments) && segments[i+1] <= from {
+				continue // every element in this segment has been committed
+			}
+			if first > through {
+				return
+			}
+			stop, err := w.replaySegment(first, from, through, elementType, selectConfig)
+			if err != nil {
+				w.report(err)
+				return
+			}
+			if stop {
+				return
+			}
+		}
+	}()
+	return output.Convert(reflect.ChanOf(reflect.RecvDir, elementType)).Interface()
+}
+
+// replaySegment sends the elements in the given segment with sequence numbers in
+// [from, through] using selectConfig. It returns true if replay should stop.
+func (w *WAL) replaySegment(first, from, through uint64, elementType reflect.Type, selectConfig []reflect.SelectCase) (bool, error) {
+	f, err := os.Open(w.segmentPath(first))
+	if err != nil {
+		return true, fmt.Errorf("failed opening WAL segment: %w", err)
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	for {
+		seq, data, err := readWALRecord(reader)
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return true, err
+		}
+		if seq < from {
+			continue
+		}
+		if seq > through {
+			return true, nil
+		}
+		elem, err := w.Codec.Unmarshal(data)
+		if err != nil {
+			return true, fmt.Errorf("failed unmarshaling WAL record %d: %w", seq, err)
+		}
+		value := reflect.ValueOf(elem)
+		if !value.IsValid() {
+			value = reflect.Zero(elementType)
+		} else if !value.Type().AssignableTo(elementType) {
+			return true, fmt.Errorf("codec produced %v, which is not assignable to %v", value.Type(), elementType)
+		}
+		selectConfig[1].Send = value
+		if chosen, _, _ := reflect.Select(selectConfig); chosen == 0 {
+			return true, nil
+		}
+	}
+}
+
+// readWALRecord reads one record. It returns io.EOF only if there are no more records, and
+// another error if the record is incomplete or corrupt.
+func readWALRecord(r io.Reader) (uint64, []byte, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+		return 0, nil, io.EOF
+	} else if err != nil {
+		return 0, nil, fmt.Errorf("failed reading WAL record header: %w", err)
+	}
+	seq := binary.BigEndian.Uint64(header[0:8])
+	data := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, fmt.Errorf("failed reading WAL record %d: %w", seq, err)
+	}
+	if crc32.Checksum(data, walTable) != binary.BigEndian.Uint32(header[12:16]) {
+		return 0, nil, fmt.Errorf("WAL record %d is corrupt", seq)
+	}
+	return seq, data, nil
+}
+
+// Close syncs and closes the log.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.closed:
+		return nil
+	default:
+	}
+	close(w.closed)
+	if w.file == nil {
+		return nil
+	}
+	if err := w.sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed closing WAL segment: %w", err)
+	}
+	w.file, w.writer = nil, nil
+	return nil
+}
+
+// log appends every element received on in to w before sending it on out. If enveloped is
+// set, the elements are Envelopes, and their values are appended and their WALSeq set. It
+// closes out when in closes or done closes.
+func (w *WAL) log(done <-chan struct{}, in, out reflect.Value, enveloped bool) {
+	defer out.Close()
+	const (
+		DoneChanClosed = 0
+		InputChanRead  = 1
+		OutputChanSent = 1
+	)
+	receive := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		InputChanRead:  {Dir: reflect.SelectRecv, Chan: in},
+	}
+	send := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		OutputChanSent: {Dir: reflect.SelectSend, Chan: out},
+	}
+	for {
+		caseChosen, elem, more := reflect.Select(receive)
+		if caseChosen == DoneChanClosed {
+			go drain(in)
+			return
+		} else if !more {
+			return
+		}
+		if enveloped {
+			envelope := elem.Interface().(Envelope)
+			seq, err := w.Append(envelope.Value)
+			if err != nil {
+				w.report(err)
+			}
+			envelope.WALSeq = seq
+			elem = reflect.ValueOf(envelope)
+		} else if _, err := w.Append(elem.Interface()); err != nil {
+			w.report(err)
+		}
+		send[OutputChanSent].Send = elem
+		if caseChosen, _, _ := reflect.Select(send); caseChosen == DoneChanClosed {
+			go drain(in)
+			return
+		}
+	}
+}
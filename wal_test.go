@@ -0,0 +1,271 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+// intCodec stores ints as decimal strings.
+type intCodec struct{}
+
+func (intCodec) Marshal(elem interface{}) ([]byte, error) {
+	return []byte(strconv.Itoa(elem.(int))), nil
+}
+
+func (intCodec) Unmarshal(data []byte) (interface{}, error) {
+	return strconv.Atoi(string(data))
+}
+
+// openTestWAL opens a WAL that sends any errors it reports on the returned channel, which
+// the test should check with expectNoErrors once nothing is using the WAL any more.
+func openTestWAL(t *testing.T, dir string, segmentBytes int64) (*fan.WAL, <-chan error) {
+	errs := make(chan error, 100)
+	wal, err := fan.OpenWAL(fan.WALConfig{
+		Dir:          dir,
+		Codec:        intCodec{},
+		SegmentBytes: segmentBytes,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed opening WAL: %v", err)
+	}
+	return wal, errs
+}
+
+func expectNoErrors(t *testing.T, errs <-chan error) {
+	for {
+		select {
+		case err := <-errs:
+			t.Errorf("unexpected error: %v", err)
+		default:
+			return
+		}
+	}
+}
+
+func replayAll(t *testing.T, wal *fan.WAL) []int {
+	done := make(chan struct{})
+	defer close(done)
+	return receiveAll(t, wal.Replay(done, reflect.TypeOf(0)).(<-chan int))
+}
+
+func TestWALReplayAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wal, errs := openTestWAL(t, dir, 64)
+	config := fan.Ints()
+	config.WAL = wal
+	in := make(chan int)
+	done := make(chan struct{})
+	out := config.FanIn(done, in).(<-chan int)
+	first := wal
+	defer func() {
+		// stop the fan-in and wait for it before closing its WAL, so that nothing is
+		// appended to a closed WAL
+		close(done)
+		for range out {
+		}
+		first.Close()
+		expectNoErrors(t, errs)
+	}()
+	go func() {
+		defer close(in)
+		for i := 0; i < 50; i++ {
+			select {
+			case <-done:
+				return
+			case in <- i:
+			}
+		}
+	}()
+	expected := make([]int, 50)
+	for i := range expected {
+		expected[i] = i
+	}
+	expectInts(t, expected, receiveAll(t, out))
+	if wal.Last() != 50 {
+		t.Fatalf("expected 50 appended elements, got %d", wal.Last())
+	}
+	// pretend that we processed the first 30 elements before crashing
+	if err := wal.Commit(30); err != nil {
+		t.Fatalf("failed committing: %v", err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("failed closing: %v", err)
+	}
+
+	wal, reopenErrs := openTestWAL(t, dir, 64)
+	defer wal.Close()
+	if wal.Committed() != 30 || wal.Last() != 50 {
+		t.Fatalf("expected committed 30 and last 50, got %d and %d", wal.Committed(), wal.Last())
+	}
+	expectInts(t, expected[30:], replayAll(t, wal))
+
+	// new elements continue the sequence
+	if seq, err := wal.Append(50); err != nil || seq != 51 {
+		t.Fatalf("expected to append sequence number 51, got %d (err %v)", seq, err)
+	}
+	expectNoErrors(t, reopenErrs)
+}
+
+func TestWALCommitRemovesSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wal, errs := openTestWAL(t, dir, 1) // every record gets its own segment
+	defer wal.Close()
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(i); err != nil {
+			t.Fatalf("failed appending: %v", err)
+		}
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if len(segments) != 10 {
+		t.Fatalf("expected 10 segments, found %d", len(segments))
+	}
+	if err := wal.Commit(7); err != nil {
+		t.Fatalf("failed committing: %v", err)
+	}
+	segments, _ = filepath.Glob(filepath.Join(dir, "*.wal"))
+	if len(segments) != 3 {
+		t.Fatalf("expected 3 segments after commit, found %d", len(segments))
+	}
+	expectInts(t, []int{7, 8, 9}, replayAll(t, wal))
+	if err := wal.Commit(11); err == nil {
+		t.Fatalf("should not be able to commit past the end of the log")
+	}
+	expectNoErrors(t, errs)
+}
+
+func TestWALTruncatesTornRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wal, errs := openTestWAL(t, dir, 0)
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(i); err != nil {
+			t.Fatalf("failed appending: %v", err)
+		}
+	}
+	wal.Close()
+	expectNoErrors(t, errs)
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 4, 0, 0}) // half of a header
+	f.Close()
+
+	wal, errs = openTestWAL(t, dir, 0)
+	defer wal.Close()
+	if wal.Last() != 3 {
+		t.Fatalf("expected torn record to be discarded, last is %d", wal.Last())
+	}
+	wal.Append(3)
+	expectInts(t, []int{0, 1, 2, 3}, replayAll(t, wal))
+	expectNoErrors(t, errs)
+}
+
+func TestWALReplayDone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wal, errs := openTestWAL(t, dir, 0)
+	defer wal.Close()
+	wal.Append(0)
+	wal.Append(1)
+	done := make(chan struct{})
+	out := wal.Replay(done, reflect.TypeOf(0)).(<-chan int)
+	<-out
+	close(done)
+	select {
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out")
+	case _, more := <-out:
+		if more {
+			// the send may have won the race with done, but the channel must close next
+			if _, more := <-out; more {
+				t.Fatalf("replay did not stop when done closed")
+			}
+		}
+	}
+	expectNoErrors(t, errs)
+}
+
+func TestWALEnvelopeSeq(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wal, errs := openTestWAL(t, dir, 0)
+	defer wal.Close()
+	config := fan.Config{WAL: wal, Envelope: &fan.EnvelopeConfig{}}
+	done := make(chan struct{})
+	defer close(done)
+	// two fan-ins share the WAL, so neither can count its way to the sequence numbers
+	outs := []<-chan fan.Envelope{
+		config.FanIn(done, sendAll(0, 1, 2, 3, 4)).(<-chan fan.Envelope),
+		config.FanIn(done, sendAll(5, 6, 7, 8, 9)).(<-chan fan.Envelope),
+	}
+	bySeq := make(map[uint64]int)
+	timeout := time.After(testTimeout)
+	for _, out := range outs {
+		for more := true; more; {
+			select {
+			case <-timeout:
+				t.Fatalf("timed out")
+			case envelope, ok := <-out:
+				if more = ok; ok {
+					bySeq[envelope.WALSeq] = envelope.Value.(int)
+				}
+			}
+		}
+	}
+	if len(bySeq) != 10 || wal.Last() != 10 {
+		t.Fatalf("expected 10 distinct sequence numbers, got %v (last %d)", bySeq, wal.Last())
+	}
+	// each envelope's sequence number is that of its element in the log
+	for i, elem := range replayAll(t, wal) {
+		if seq := uint64(i + 1); bySeq[seq] != elem {
+			t.Fatalf("envelope with sequence number %d held %d, but the log holds %d", seq, bySeq[seq], elem)
+		}
+	}
+	if err := wal.Commit(10); err != nil {
+		t.Fatalf("failed committing: %v", err)
+	}
+	expectInts(t, nil, replayAll(t, wal))
+	expectNoErrors(t, errs)
+}
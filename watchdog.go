@@ -0,0 +1,213 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package fan
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WatchdogConfig configures a watchdog that reports fan-in workers that appear to be stuck.
+// With a watchdog, each element passes through an extra goroutine that records when it was
+// received and how long it took to send.
+type WatchdogConfig struct {
+	// SendTimeout, if positive, is how long a worker may be blocked sending an element before
+	// it is reported as BlockedOnSend. That usually means the output is not being drained.
+	SendTimeout time.Duration
+
+	// Heartbeat, if positive, is how long an input may go without producing an element
+	// before it is reported as InputIdle.
+	Heartbeat time.Duration
+
+	// Interval is how often the watchdog checks the workers. If it is zero, half of the
+	// smaller of SendTimeout and Heartbeat is used, but no less than a millisecond. It may not
+	// be negative.
+	Interval time.Duration
+
+	// OnStall is called from the watchdog's goroutine once for each stall that it notices.
+	// A stall is reported again only after the worker has made progress and stalled again.
+	OnStall func(Stall)
+}
+
+// minWatchdogInterval is the shortest interval that a watchdog picks for itself when
+// WatchdogConfig.Interval is not set, so that tiny timeouts do not make it check constantly.
+const minWatchdogInterval = time.Millisecond
+
+// StallKind describes what a stalled worker is waiting for.
+type StallKind int
+
+const (
+	// BlockedOnSend means that the worker has received an element and has been waiting to
+	// send it for longer than SendTimeout.
+	BlockedOnSend StallKind = iota
+	// InputIdle means that the input has not produced an element for longer than Heartbeat.
+	InputIdle
+)
+
+// String returns the name of the kind of stall.
+func (k StallKind) String() string {
+	switch k {
+	case BlockedOnSend:
+		return "BlockedOnSend"
+	case InputIdle:
+		return "InputIdle"
+	}
+	return "StallKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Stall is a report of a stuck worker.
+type Stall struct {
+	// Input is the index of the channel (as passed to FanIn) that the worker reads.
+	Input int
+	// Kind is what the worker is waiting for.
+	Kind StallKind
+	// Duration is how long the worker has been waiting.
+	Duration time.Duration
+}
+
+// watchState is what the watchdog knows about one worker. It is guarded by the watchdog's
+// mutex.
+type watchState struct {
+	// received is when the worker last produced an element (or started), and sending is
+	// when it began waiting to send the element, or zero if it is not waiting
+	received time.Time
+	sending  time.Time
+	// blockedReported and idleReported are set once the current wait has been reported
+	blockedReported bool
+	idleReported    bool
+}
+
+// watchdog tracks the workers of one fan-in.
+type watchdog struct {
+	config  *WatchdogConfig
+	mutex   sync.Mutex
+	inputs  map[int]*watchState
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// watchdog starts a watchdog for a fan-in if the config has one, or returns nil. It panics if
+// the watchdog's Interval is negative.
+func (c Config) watchdog(done <-chan struct{}) *watchdog {
+	if c.Watchdog != nil && c.Watchdog.Interval < 0 {
+		panic(fmt.Errorf("WatchdogConfig.Interval must not be negative, got %v", c.Watchdog.Interval))
+	}
+	if c.Watchdog == nil || (c.Watchdog.SendTimeout <= 0 && c.Watchdog.Heartbeat <= 0) {
+		return nil
+	}
+	w := &watchdog{
+		config:  c.Watchdog,
+		inputs:  make(map[int]*watchState),
+		stopped: make(chan struct{}),
+	}
+	go w.check(done)
+	return w
+}
+
+// stop ends the watchdog's checks. It is safe to call on a nil watchdog, and more than once.
+func (w *watchdog) stop() {
+	if w != nil {
+		w.once.Do(func() { close(w.stopped) })
+	}
+}
+
+// check periodically reports stalls until done closes or the watchdog stops.
+func (w *watchdog) check(done <-chan struct{}) {
+	interval := w.config.Interval
+	if interval <= 0 {
+		interval = w.config.SendTimeout
+		if interval <= 0 || (w.config.Heartbeat > 0 && w.config.Heartbeat < interval) {
+			interval = w.config.Heartbeat
+		}
+		interval /= 2
+		if interval < minWatchdogInterval {
+			interval = minWatchdogInterval
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var stalls []Stall
+	for {
+		select {
+		case <-done:
+			return
+		case <-w.stopped:
+			return
+		case now := <-ticker.C:
+			stalls = w.stalls(now, stalls[:0])
+			for _, stall := range stalls {
+				if w.config.OnStall != nil {
+					w.config.OnStall(stall)
+				}
+			}
+		}
+	}
+}
+
+// stalls appends the stalls that have not been reported yet to found.
+func (w *watchdog) stalls(now time.Time, found []Stall) []Stall {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for input, state := range w.inputs {
+		if !state.sending.IsZero() {
+			if blocked := now.Sub(state.sending); w.config.SendTimeout > 0 && blocked > w.config.SendTimeout && !state.blockedReported {
+				state.blockedReported = true
+				found = append(found, Stall{Input: input, Kind: BlockedOnSend, Duration: blocked})
+			}
+		} else if idle := now.Sub(state.received); w.config.Heartbeat > 0 && idle > w.config.Heartbeat && !state.idleReported {
+			state.idleReported = true
+			found = append(found, Stall{Input: input, Kind: InputIdle, Duration: idle})
+		}
+	}
+	return found
+}
+
+// relay forwards the elements that a worker sends on in to out, recording its progress. It
+// calls finished once in closes.
+func (w *watchdog) relay(done <-chan struct{}, input int, in, out reflect.Value, finished func()) {
+	state := &watchState{received: time.Now()}
+	w.mutex.Lock()
+	w.inputs[input] = state
+	w.mutex.Unlock()
+	defer func() {
+		w.mutex.Lock()
+		delete(w.inputs, input)
+		w.mutex.Unlock()
+		finished()
+	}()
+	const (
+		DoneChanClosed = 0
+		OutputChanSent = 1
+	)
+	selectConfig := []reflect.SelectCase{
+		DoneChanClosed: {Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		OutputChanSent: {Dir: reflect.SelectSend, Chan: out},
+	}
+	for {
+		elem, more := in.Recv()
+		if !more {
+			return
+		}
+		now := time.Now()
+		w.mutex.Lock()
+		state.received, state.sending = now, now
+		state.blockedReported, state.idleReported = false, false
+		w.mutex.Unlock()
+		selectConfig[OutputChanSent].Send = elem
+		if caseChosen, _, _ := reflect.Select(selectConfig); caseChosen == DoneChanClosed {
+			// keep receiving so that our worker isn't stuck sending to us
+			drain(in)
+			return
+		}
+		w.mutex.Lock()
+		state.received, state.sending = time.Now(), time.Time{}
+		w.mutex.Unlock()
+	}
+}
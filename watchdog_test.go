@@ -0,0 +1,102 @@
+/*
+Copyright IBM Corporation All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package fan_test
+
+import (
+	"testing"
+	"time"
+
+	fan "github.com/IBM/fast-fan-in"
+)
+
+func expectStall(t *testing.T, stalls <-chan fan.Stall, input int, kind fan.StallKind, threshold time.Duration) {
+	select {
+	case stall := <-stalls:
+		if stall.Input != input || stall.Kind != kind || stall.Duration < threshold {
+			t.Fatalf("expected %v for input %d, got %+v", kind, input, stall)
+		}
+	case <-time.NewTicker(time.Millisecond * 100).C:
+		t.Fatalf("no stall was reported")
+	}
+}
+
+func TestWatchdogBlockedOnSend(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	stalls := make(chan fan.Stall, 10)
+	output := fan.Config{
+		SelectFunc: fan.Ints().SelectFunc,
+		Watchdog: &fan.WatchdogConfig{
+			SendTimeout: time.Millisecond * 5,
+			OnStall:     func(stall fan.Stall) { stalls <- stall },
+		},
+	}.FanIn(done, sendAll(1, 2)).(<-chan int)
+
+	// nobody is receiving, so the worker blocks
+	expectStall(t, stalls, 0, fan.BlockedOnSend, time.Millisecond*5)
+	// the stall is only reported once
+	time.Sleep(time.Millisecond * 20)
+	if len(stalls) != 0 {
+		t.Fatalf("stall was reported more than once")
+	}
+	// once it makes progress it can stall again
+	<-output
+	expectStall(t, stalls, 0, fan.BlockedOnSend, time.Millisecond*5)
+	expectInts(t, receiveAll(t, output), []int{2})
+}
+
+func TestWatchdogInputIdle(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	stalls := make(chan fan.Stall, 10)
+	busy, idle := make(chan int), make(chan int)
+	output := fan.Config{
+		Watchdog: &fan.WatchdogConfig{
+			Heartbeat: time.Millisecond * 20,
+			Interval:  time.Millisecond,
+			OnStall:   func(stall fan.Stall) { stalls <- stall },
+		},
+	}.FanIn(done, busy, idle).(<-chan int)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case elem := <-output:
+				busy <- elem
+			}
+		}
+	}()
+	busy <- 0
+	expectStall(t, stalls, 1, fan.InputIdle, time.Millisecond*20)
+}
+
+func TestWatchdogTinyTimeout(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	stalls := make(chan fan.Stall, 10)
+	// half of the timeout rounds down to nothing, so the watchdog picks its own interval
+	fan.Config{
+		Watchdog: &fan.WatchdogConfig{
+			SendTimeout: time.Nanosecond,
+			OnStall:     func(stall fan.Stall) { stalls <- stall },
+		},
+	}.FanIn(done, sendAll(1))
+	expectStall(t, stalls, 0, fan.BlockedOnSend, time.Nanosecond)
+}
+
+func TestWatchdogNegativeInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("should have panicked with a negative interval")
+		}
+	}()
+	done := make(chan struct{})
+	defer close(done)
+	fan.Config{
+		Watchdog: &fan.WatchdogConfig{SendTimeout: time.Second, Interval: -time.Second},
+	}.FanIn(done, make(chan int))
+}